@@ -74,10 +74,34 @@ func SetupWorkerConfig() {
 	config.Configuration.ColdStorageStartCapacitySize = viper.GetInt64("cold_storage.start_capacity_size")
 	config.Configuration.ColdStorageDeleteLocalCopy = viper.GetBool("cold_storage.delete_local_copy")
 	config.Configuration.ColdStorageDeleteCloudCopy = viper.GetBool("cold_storage.delete_cloud_copy")
+	config.Configuration.ColdStorageTier = viper.GetString("cold_storage.tier")
+	config.Configuration.ColdStorageLocalPath = viper.GetString("cold_storage.local_path")
+	config.Configuration.ColdStoragePromoteAfterReads = viper.GetInt64("cold_storage.promote_after_reads")
+	config.Configuration.ColdStorageCacheSize = viper.GetInt64("cold_storage.cache_size")
 
 	config.Configuration.MinioStart = viper.GetBool("minio.start")
 	config.Configuration.MinioWorkerFreq = viper.GetInt64("minio.worker_frequency")
 	config.Configuration.MinioUseSSL = viper.GetBool("minio.use_ssl")
+	if config.Configuration.MinioStart && len(config.Configuration.ColdStorageTier) == 0 {
+		config.Configuration.ColdStorageTier = config.ColdTierMinio
+	}
+
+	config.Configuration.EncryptionAtRestKeyFile = viper.GetString("encryption_at_rest.master_key_file")
+
+	config.Configuration.CompressionEnabled = viper.GetBool("compression.enabled")
+	config.Configuration.CompressionLevel = viper.GetInt("compression.level")
+
+	config.Configuration.ScrubEnabled = viper.GetBool("scrub.enabled")
+	config.Configuration.ScrubFreq = viper.GetInt64("scrub.frequency")
+	config.Configuration.ScrubBytesPerSecond = viper.GetInt64("scrub.bytes_per_second")
+	config.Configuration.ScrubRestoreFromCloud = viper.GetBool("scrub.restore_from_cloud")
+
+	config.Configuration.TrashRetentionPeriod = viper.GetInt64("trash.retention_period")
+	config.Configuration.TrashWorkerFreq = viper.GetInt64("trash.frequency")
+
+	config.Configuration.ExpiryWorkerFreq = viper.GetInt64("expiry.frequency")
+
+	config.Configuration.HistoryWriteMarkers = viper.GetInt("history.num_write_markers")
 
 	config.Configuration.Capacity = viper.GetInt64("capacity")
 	config.Configuration.MaxFileSize = viper.GetInt64("max_file_size")
@@ -274,16 +298,18 @@ func main() {
 	publicKey, privateKey, _, _ := encryption.ReadKeys(reader)
 	reader.Close()
 
-	reader, err = os.Open(*minioFile)
-	if err != nil {
-		panic(err)
-	}
+	if config.Configuration.ColdStorageTier == config.ColdTierMinio {
+		reader, err = os.Open(*minioFile)
+		if err != nil {
+			panic(err)
+		}
 
-	err = processMinioConfig(reader)
-	if err != nil {
-		panic(err)
+		err = processMinioConfig(reader)
+		if err != nil {
+			panic(err)
+		}
+		reader.Close()
 	}
-	reader.Close()
 
 	node.Self.SetKeys(publicKey, privateKey)
 
@@ -319,6 +345,8 @@ func main() {
 
 	// Initializa after serverchain is setup.
 	initEntities()
+	// finish the commits interrupted by a crash before serving requests
+	allocation.RecoverCommits(common.GetRootContext())
 	//miner.GetMinerChain().SetupGenesisBlock(viper.GetString("server_chain.genesis_block.id"))
 	SetupBlobberOnBC(*logDir)
 	mode := "main net"
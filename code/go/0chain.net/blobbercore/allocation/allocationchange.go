@@ -12,12 +12,17 @@ import (
 )
 
 const (
-	INSERT_OPERATION       = "insert"
-	DELETE_OPERATION       = "delete"
-	UPDATE_OPERATION       = "update"
-	RENAME_OPERATION       = "rename"
-	COPY_OPERATION         = "copy"
-	UPDATE_ATTRS_OPERATION = "update_attrs"
+	INSERT_OPERATION          = "insert"
+	DELETE_OPERATION          = "delete"
+	UPDATE_OPERATION          = "update"
+	RENAME_OPERATION          = "rename"
+	COPY_OPERATION            = "copy"
+	MOVE_OPERATION            = "move"
+	CREATEDIR_OPERATION       = "createdir"
+	UPDATE_ATTRS_OPERATION    = "update_attrs"
+	RESTORE_VERSION_OPERATION = "restore_version"
+	RESTORE_TRASH_OPERATION   = "restore_trash"
+	UPDATE_XATTRS_OPERATION   = "update_xattrs"
 )
 
 const (
@@ -91,6 +96,40 @@ func GetAllocationChanges(ctx context.Context, connectionID string, allocationID
 	return nil, err
 }
 
+// GetOpenConnections returns the connections of the allocation not yet
+// committed or deleted, oldest first, only the ones of the client if its id
+// isn't empty.
+func GetOpenConnections(ctx context.Context, allocationID string, clientID string) ([]*AllocationChangeCollector, error) {
+	var connections []*AllocationChangeCollector
+	db := datastore.GetStore().GetTransaction(ctx)
+	query := db.Where("allocation_id = ? AND status IN (?,?)", allocationID, NewConnection, InProgressConnection)
+	if len(clientID) != 0 {
+		query = query.Where("client_id = ?", clientID)
+	}
+	err := query.Order("created_at").Preload("Changes").Find(&connections).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, cc := range connections {
+		cc.ComputeProperties()
+	}
+	return connections, nil
+}
+
+// GetOpenConnection returns the connection of the allocation if it's not
+// yet committed or deleted.
+func GetOpenConnection(ctx context.Context, allocationID string, connectionID string) (*AllocationChangeCollector, error) {
+	cc := &AllocationChangeCollector{}
+	db := datastore.GetStore().GetTransaction(ctx)
+	err := db.Where("connection_id = ? AND allocation_id = ? AND status IN (?,?)",
+		connectionID, allocationID, NewConnection, InProgressConnection).Preload("Changes").First(cc).Error
+	if err != nil {
+		return nil, err
+	}
+	cc.ComputeProperties()
+	return cc, nil
+}
+
 func (cc *AllocationChangeCollector) AddChange(allocationChange *AllocationChange, changeProcessor AllocationChangeProcessor) {
 	cc.AllocationChanges = append(cc.AllocationChanges, changeProcessor)
 	allocationChange.Input, _ = changeProcessor.Marshal()
@@ -125,8 +164,18 @@ func (cc *AllocationChangeCollector) ComputeProperties() {
 			acp = new(RenameFileChange)
 		case COPY_OPERATION:
 			acp = new(CopyFileChange)
+		case MOVE_OPERATION:
+			acp = new(MoveFileChange)
+		case CREATEDIR_OPERATION:
+			acp = new(CreateDirChange)
 		case UPDATE_ATTRS_OPERATION:
 			acp = new(AttributesChange)
+		case RESTORE_VERSION_OPERATION:
+			acp = new(RestoreVersionChange)
+		case RESTORE_TRASH_OPERATION:
+			acp = new(RestoreTrashChange)
+		case UPDATE_XATTRS_OPERATION:
+			acp = new(XAttrsChange)
 		}
 
 		if acp == nil {
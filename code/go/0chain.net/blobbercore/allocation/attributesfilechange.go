@@ -59,21 +59,25 @@ func (ac *AttributesChange) ProcessChange(ctx context.Context,
 		}
 	}
 
-	var idx = -1
-	for i, child := range dirRef.Children {
-		if child.Type == reference.FILE && child.Path == ac.Path {
-			idx = i
+	// directories have attributes too, the root directory ones applying
+	// to the whole allocation
+	var existingRef *reference.Ref
+	if ac.Path == "/" {
+		existingRef = ref
+	}
+	for _, child := range dirRef.Children {
+		if child.Path == ac.Path {
+			existingRef = child
 			break
 		}
 	}
 
-	if idx < 0 {
+	if existingRef == nil {
 		Logger.Error("error in file attributes update", zap.Any("change", ac))
 		return nil, common.NewError("process_attrs_update",
 			"file to update not found in blobber")
 	}
 
-	var existingRef = dirRef.Children[idx]
 	existingRef.WriteMarker = allocRoot
 	if err = existingRef.SetAttributes(ac.Attributes); err != nil {
 		return nil, common.NewErrorf("process_attrs_update",
@@ -85,7 +89,9 @@ func (ac *AttributesChange) ProcessChange(ctx context.Context,
 			"saving updated reference: %v", err)
 	}
 
-	stats.FileUpdated(ctx, existingRef.ID)
+	if existingRef.Type == reference.FILE {
+		stats.FileUpdated(ctx, existingRef.ID)
+	}
 	return
 }
 
@@ -95,6 +95,7 @@ func (rf *CopyFileChange) processCopyRefs(ctx context.Context, affectedRef *refe
 		newRef.Name = affectedRef.Name
 		newRef.LookupHash = reference.GetReferenceLookup(newRef.AllocationID, newRef.Path)
 		newRef.Attributes = datatypes.JSON(string(affectedRef.Attributes))
+		newRef.XAttrs = affectedRef.XAttrs
 		destRef.AddChild(newRef)
 		for _, childRef := range affectedRef.Children {
 			rf.processCopyRefs(ctx, childRef, newRef, allocationRoot)
@@ -120,6 +121,7 @@ func (rf *CopyFileChange) processCopyRefs(ctx context.Context, affectedRef *refe
 		newFile.ActualThumbnailSize = affectedRef.ActualThumbnailSize
 		newFile.EncryptedKey = affectedRef.EncryptedKey
 		newFile.Attributes = datatypes.JSON(string(affectedRef.Attributes))
+		newFile.XAttrs = affectedRef.XAttrs
 
 		destRef.AddChild(newFile)
 	}
@@ -0,0 +1,85 @@
+package allocation
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+)
+
+// CreateDirChange creates a directory, with its missing parents, so empty
+// directories can exist. Creating an existing directory does nothing.
+type CreateDirChange struct {
+	ConnectionID string `json:"connection_id"`
+	AllocationID string `json:"allocation_id"`
+	Path         string `json:"path"`
+}
+
+func (cd *CreateDirChange) DeleteTempFile() error {
+	return OperationNotApplicable
+}
+
+func (cd *CreateDirChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
+	path := filepath.Clean(cd.Path)
+	rootRef, err := reference.GetReferencePath(ctx, cd.AllocationID, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = makeDirs(rootRef, path); err != nil {
+		return nil, err
+	}
+
+	_, err = rootRef.CalculateHash(ctx, true)
+	return rootRef, err
+}
+
+// makeDirs returns the directory at the path in the reference path loaded,
+// creating it with its missing parents.
+func makeDirs(rootRef *reference.Ref, path string) (*reference.Ref, error) {
+	tSubDirs := reference.GetSubDirsFromPath(path)
+	dirRef := rootRef
+	for treelevel := range tSubDirs {
+		var found *reference.Ref
+		for _, child := range dirRef.Children {
+			if child.Name == tSubDirs[treelevel] {
+				found = child
+				break
+			}
+		}
+		if found != nil && found.Type != reference.DIRECTORY {
+			return nil, common.NewError("invalid_parameters", "Invalid path. A file exists at "+found.Path)
+		}
+		if found == nil {
+			found = reference.NewEmptyDirectoryRef()
+			found.AllocationID = dirRef.AllocationID
+			found.Path = "/" + strings.Join(tSubDirs[:treelevel+1], "/")
+			found.ParentPath = dirRef.Path
+			found.Name = tSubDirs[treelevel]
+			found.LookupHash = reference.GetReferenceLookup(dirRef.AllocationID, found.Path)
+			dirRef.AddChild(found)
+		}
+		dirRef = found
+	}
+	return dirRef, nil
+}
+
+func (cd *CreateDirChange) Marshal() (string, error) {
+	ret, err := json.Marshal(cd)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func (cd *CreateDirChange) Unmarshal(input string) error {
+	err := json.Unmarshal([]byte(input), cd)
+	return err
+}
+
+func (cd *CreateDirChange) CommitToFileStore(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package allocation
+
+import (
+	"testing"
+
+	"0chain.net/blobbercore/reference"
+)
+
+func TestMakeDirs(t *testing.T) {
+	const allocationID = "alloc"
+
+	rootRef := reference.NewEmptyDirectoryRef()
+	rootRef.AllocationID = allocationID
+	rootRef.Path = "/"
+	fileRef := reference.NewFileRef()
+	fileRef.AllocationID = allocationID
+	fileRef.Name = "file"
+	fileRef.Path = "/a/file"
+
+	dirRef, err := makeDirs(rootRef, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirRef.AddChild(fileRef)
+
+	dirRef, err = makeDirs(rootRef, "/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirRef.Path != "/a/b/c" || dirRef.ParentPath != "/a/b" || dirRef.Name != "c" ||
+		dirRef.LookupHash != reference.GetReferenceLookup(allocationID, "/a/b/c") {
+		t.Errorf("unexpected directory %s in %s named %s", dirRef.Path, dirRef.ParentPath, dirRef.Name)
+	}
+
+	// existing directories are reused
+	again, err := makeDirs(rootRef, "/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != dirRef || len(rootRef.Children) != 1 {
+		t.Error("expected the existing directories to be returned")
+	}
+	if len(rootRef.Children[0].Children) != 2 {
+		t.Errorf("got %d children of /a, want 2", len(rootRef.Children[0].Children))
+	}
+
+	// files aren't replaced, nor used as directories
+	for _, path := range []string{"/a/file", "/a/file/d"} {
+		if _, err = makeDirs(rootRef, path); err == nil {
+			t.Errorf("%s: expected error", path)
+		}
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"path/filepath"
+	"time"
 
+	"0chain.net/blobbercore/config"
 	"0chain.net/blobbercore/reference"
 	"0chain.net/core/common"
-	"0chain.net/blobbercore/datastore"
 	"0chain.net/blobbercore/filestore"
 	. "0chain.net/core/logging"
 
@@ -59,15 +60,26 @@ func (nf *DeleteFileChange) ProcessChange(ctx context.Context, change *Allocatio
 	}
 	idx := -1
 	for i, child := range dirRef.Children {
-		if child.Hash == nf.Hash && child.Hash == affectedRef.Hash {
+		// the hash of a directory changes with the changes to its subtree
+		// made earlier in the connection
+		if child.Path == affectedRef.Path && (child.Type == reference.DIRECTORY ||
+			(child.Hash == nf.Hash && child.Hash == affectedRef.Hash)) {
 			idx = i
 			nf.ContentHash = make(map[string]bool)
 			reference.DeleteReference(ctx, child.ID, child.PathHash)
-			if child.Type == reference.FILE {
-				nf.ContentHash[child.ThumbnailHash] = true
-				nf.ContentHash[child.ContentHash] = true
-			} else {
-				nf.processChildren(ctx, affectedRef)
+			var subtree []*reference.Ref
+			if child.Type == reference.DIRECTORY {
+				subtree = nf.processChildren(ctx, affectedRef)
+			}
+			if config.Configuration.TrashRetentionPeriod > 0 {
+				// the refs stay soft-deleted with their content and
+				// versions until the trash entry is purged
+				expiresAt := time.Now().Add(time.Duration(config.Configuration.TrashRetentionPeriod) * time.Second)
+				if _, err = reference.AddTrashEntry(ctx, child, subtree, expiresAt); err != nil {
+					return nil, common.NewError("trash_error", "Error moving the object to the trash. "+err.Error())
+				}
+			} else if err = nf.releaseFiles(ctx, append(subtree, child)); err != nil {
+				return nil, err
 			}
 			break
 		}
@@ -82,16 +94,55 @@ func (nf *DeleteFileChange) ProcessChange(ctx context.Context, change *Allocatio
 	return nil, nil
 }
 
-func (nf *DeleteFileChange) processChildren(ctx context.Context, curRef *reference.Ref) {
+// processChildren deletes the refs of the subtree of the directory and
+// returns them.
+func (nf *DeleteFileChange) processChildren(ctx context.Context, curRef *reference.Ref) []*reference.Ref {
+	var refs []*reference.Ref
 	for _, childRef := range curRef.Children {
 		reference.DeleteReference(ctx, childRef.ID, childRef.PathHash)
-		if childRef.Type == reference.FILE {
-			nf.ContentHash[childRef.ThumbnailHash] = true
-			nf.ContentHash[childRef.ContentHash] = true
-		} else if childRef.Type == reference.DIRECTORY {
-			nf.processChildren(ctx, childRef)
+		refs = append(refs, childRef)
+		if childRef.Type == reference.DIRECTORY {
+			refs = append(refs, nf.processChildren(ctx, childRef)...)
+		}
+	}
+	return refs
+}
+
+// releaseFiles deletes the versions of the deleted files and marks their
+// content to be released once committed.
+func (nf *DeleteFileChange) releaseFiles(ctx context.Context, refs []*reference.Ref) error {
+	for _, ref := range refs {
+		if ref.Type != reference.FILE {
+			continue
+		}
+		nf.ContentHash[ref.ThumbnailHash] = true
+		nf.ContentHash[ref.ContentHash] = true
+		if err := deleteFileVersions(ctx, ref, nf.ContentHash); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// deleteFileVersions deletes the versions kept for the deleted file,
+// releasing their size from the allocation, and adds their content to the
+// released ones.
+func deleteFileVersions(ctx context.Context, fileRef *reference.Ref, released map[string]bool) error {
+	versions, err := reference.PruneFileVersions(ctx, fileRef.ID, 0)
+	if err != nil {
+		return common.NewError("file_version_error", "Error deleting the file versions. "+err.Error())
+	}
+	var size int64
+	for _, version := range versions {
+		size += version.Size
+		for _, hash := range version.ContentHashes() {
+			released[hash] = true
+		}
+	}
+	if err = AddUsedSize(ctx, fileRef.AllocationID, -size); err != nil {
+		return common.NewError("file_version_error", "Error updating the allocation size. "+err.Error())
+	}
+	return nil
 }
 
 func (nf *DeleteFileChange) Marshal() (string, error) {
@@ -111,15 +162,39 @@ func (nf *DeleteFileChange) DeleteTempFile() error {
 	return OperationNotApplicable
 }
 
+// CommitToFileStore has nothing to commit, the content released is
+// journaled with the commit.
 func (nf *DeleteFileChange) CommitToFileStore(ctx context.Context) error {
-	db := datastore.GetStore().GetTransaction(ctx)
-	for contenthash := range nf.ContentHash {
-		var count int64
-		err := db.Table((&reference.Ref{}).TableName()).Where(&reference.Ref{ThumbnailHash: contenthash}).Or(&reference.Ref{ContentHash: contenthash}).Count(&count).Error
-		if err == nil && count == 0 {
-			Logger.Info("Deleting content file", zap.String("content_hash", contenthash))
-			filestore.GetFileStore().DeleteFile(nf.AllocationID, contenthash)
+	return nil
+}
+
+func (nf *DeleteFileChange) releasedContentHashes() map[string]bool {
+	return nf.ContentHash
+}
+
+// ReleaseContent deletes the object stored under the content hash from the
+// allocation once no file of the allocation uses it anymore. Its cloud copy,
+// shared by all allocations unless encrypted, is deleted once no file uses
+// it anymore.
+func ReleaseContent(ctx context.Context, allocationID string, contentHash string) {
+	count, err := reference.CountContentReferences(ctx, allocationID, contentHash)
+	if err != nil || count > 0 {
+		return
+	}
+	Logger.Info("Deleting content file", zap.String("content_hash", contentHash))
+	filestore.GetFileStore().DeleteFile(allocationID, contentHash)
+
+	if !config.ColdStorageEnabled() || !config.Configuration.ColdStorageDeleteCloudCopy {
+		return
+	}
+	// encrypted cloud copies aren't shared with other allocations
+	if !config.EncryptionAtRestEnabled() {
+		count, err = reference.CountContentReferences(ctx, "", contentHash)
+		if err != nil || count > 0 {
+			return
 		}
 	}
-	return nil
-}
\ No newline at end of file
+	if err = filestore.GetFileStore().RemoveFromCloud(allocationID, contentHash); err != nil {
+		Logger.Error("Unable to delete object from minio", zap.Error(err))
+	}
+}
@@ -1,9 +1,11 @@
 package allocation
 
 import (
+	"context"
 	"errors"
 	"time"
 
+	"0chain.net/blobbercore/datastore"
 	"0chain.net/core/common"
 
 	"gorm.io/gorm"
@@ -46,6 +48,35 @@ func (Allocation) TableName() string {
 	return "allocations"
 }
 
+// AddUsedSize accounts the size of the content the blobber retains, or
+// releases if negative, in the used size of the allocation, for the changes
+// not made by write markers.
+func AddUsedSize(ctx context.Context, allocationID string, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Model(&Allocation{}).Where("id = ?", allocationID).Updates(map[string]interface{}{
+		"blobber_size_used": gorm.Expr("blobber_size_used + ?", size),
+		"used_size":         gorm.Expr("used_size + ?", size),
+	}).Error
+}
+
+// GetBlobberSizeUsed returns the size used by the allocation on the blobber,
+// with the changes of the transaction.
+func GetBlobberSizeUsed(ctx context.Context, allocationID string) (int64, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var sizes []int64
+	err := db.Model(&Allocation{}).Where("id = ?", allocationID).Pluck("blobber_size_used", &sizes).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(sizes) == 0 {
+		return 0, common.NewError("allocation_not_found", "Could not find the allocation")
+	}
+	return sizes[0], nil
+}
+
 // RestDurationInTimeUnits returns number (float point) of time units until
 // allocation ends.
 func (a *Allocation) RestDurationInTimeUnits(wmt common.Timestamp) (
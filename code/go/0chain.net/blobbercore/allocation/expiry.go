@@ -0,0 +1,194 @@
+package allocation
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"0chain.net/blobbercore/config"
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// EXPIRY_BATCH_SIZE is the number of expired files of an allocation deleted
+// at once.
+const EXPIRY_BATCH_SIZE = 1000
+
+// ExpiryWorker periodically queues the deletions of the files past their
+// expires_at attribute.
+func ExpiryWorker(ctx context.Context) {
+	var tk = time.NewTicker(time.Duration(config.Configuration.ExpiryWorkerFreq) * time.Second)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+			expireFiles(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func getExpiredFiles(ctx context.Context, allocationID string, now common.Timestamp) ([]*reference.Ref, error) {
+	var (
+		tx   = datastore.GetStore().GetTransaction(ctx)
+		refs []*reference.Ref
+	)
+	query := tx.Where("type = ? AND (attributes->>'expires_at')::bigint <= ?", reference.FILE, now)
+	if len(allocationID) != 0 {
+		query = query.Where("allocation_id = ?", allocationID)
+	}
+	err := query.Order("path").Limit(EXPIRY_BATCH_SIZE).Find(&refs).Error
+	return refs, err
+}
+
+func expireFiles(ctx context.Context) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	refs, err := getExpiredFiles(rctx, "", common.Now())
+	datastore.GetStore().GetTransaction(rctx).Rollback()
+	if err != nil {
+		Logger.Error("getting expired files", zap.Error(err))
+		return
+	}
+
+	var done = make(map[string]bool)
+	for _, ref := range refs {
+		if done[ref.AllocationID] {
+			continue
+		}
+		done[ref.AllocationID] = true
+		if err = deleteExpiredFiles(ctx, ref.AllocationID); err != nil {
+			Logger.Error("deleting expired files", zap.Any("allocation", ref.AllocationID), zap.Error(err))
+		}
+	}
+}
+
+// ExpiryConnectionPrefix prefixes the ids of the connections the deletions
+// of the expired files are queued in. The blobber can't sign a write marker,
+// the owner commits them as any other connection, found with the open
+// connections of the allocation.
+const ExpiryConnectionPrefix = "expiry:"
+
+// IsExpiryConnection tells whether the connection was opened by the expiry
+// worker.
+func IsExpiryConnection(connectionID string) bool {
+	return strings.HasPrefix(connectionID, ExpiryConnectionPrefix)
+}
+
+// newExpiryConnectionID returns the id of a new expiry connection. Each run
+// opens a connection of its own, the ones committed or deleted are never
+// reused.
+func newExpiryConnectionID() string {
+	return ExpiryConnectionPrefix + newConnectionID()
+}
+
+// planExpiry returns the open expiry connections gone stale, a deletion
+// queued in them no longer matching the ref at its path, and the expired
+// refs not queued in the other ones. The refs are looked up with getRef.
+func planExpiry(connections []*AllocationChangeCollector, expired []*reference.Ref,
+	getRef func(path string) *reference.Ref) (stale []*AllocationChangeCollector, queue []*reference.Ref) {
+
+	var queued = make(map[string]bool)
+	for _, conn := range connections {
+		if !IsExpiryConnection(conn.ConnectionID) ||
+			(conn.Status != NewConnection && conn.Status != InProgressConnection) {
+			continue
+		}
+		var paths []string
+		for _, change := range conn.AllocationChanges {
+			dfc, ok := change.(*DeleteFileChange)
+			if !ok {
+				continue
+			}
+			if ref := getRef(dfc.Path); ref == nil || ref.Hash != dfc.Hash {
+				paths = nil
+				stale = append(stale, conn)
+				break
+			}
+			paths = append(paths, dfc.Path)
+		}
+		for _, path := range paths {
+			queued[path] = true
+		}
+	}
+	for _, ref := range expired {
+		if !queued[ref.Path] {
+			queue = append(queue, ref)
+		}
+	}
+	return
+}
+
+// deleteExpiredFiles queues the deletions of the expired files of the
+// allocation in a new expiry connection, for the owner to commit. The refs
+// and the allocation root are left as they are until then. The expiry
+// connections with a deletion of a file changed since are deleted, and their
+// files still expired queued again.
+func deleteExpiredFiles(ctx context.Context, allocationID string) (err error) {
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+	var tx = datastore.GetStore().GetTransaction(ctx)
+	defer commit(tx, &err)
+
+	var a = new(Allocation)
+	if err = tx.Where("id = ?", allocationID).First(a).Error; err != nil {
+		return
+	}
+	if a.Finalized || a.CleanedUp {
+		return
+	}
+
+	// not committed nor aborted meanwhile
+	var mutex = lock.GetMutex(a.TableName(), a.ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var refs []*reference.Ref
+	if refs, err = getExpiredFiles(ctx, a.ID, common.Now()); err != nil || len(refs) == 0 {
+		return
+	}
+
+	var connections []*AllocationChangeCollector
+	if connections, err = GetOpenConnections(ctx, a.ID, a.OwnerID); err != nil {
+		return
+	}
+	stale, queue := planExpiry(connections, refs, func(path string) *reference.Ref {
+		ref, _ := reference.GetReference(ctx, a.ID, path)
+		return ref
+	})
+	for _, conn := range stale {
+		Logger.Info("deleting a stale expiry connection", zap.Any("allocation", a.ID), zap.Any("connection", conn.ConnectionID))
+		if err = deleteExpiryConnection(ctx, conn); err != nil {
+			return
+		}
+	}
+	if len(queue) == 0 {
+		return
+	}
+
+	var conn *AllocationChangeCollector
+	if conn, err = GetAllocationChanges(ctx, newExpiryConnectionID(), a.ID, a.OwnerID); err != nil {
+		return
+	}
+	for _, ref := range queue {
+		Logger.Info("queueing the deletion of an expired file", zap.Any("allocation", a.ID), zap.Any("path", ref.Path))
+		if err = deleteFile(ctx, ref.Path, conn); err != nil {
+			return
+		}
+	}
+	return conn.Save(ctx)
+}
+
+func deleteExpiryConnection(ctx context.Context, conn *AllocationChangeCollector) error {
+	var mutex = lock.GetMutex(conn.TableName(), conn.ConnectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var tx = datastore.GetStore().GetTransaction(ctx)
+	return tx.Model(conn).Updates(AllocationChangeCollector{Status: DeletedConnection}).Error
+}
@@ -0,0 +1,122 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+
+	"0chain.net/blobbercore/reference"
+)
+
+func TestNewExpiryConnectionID(t *testing.T) {
+	id := newExpiryConnectionID()
+	if !IsExpiryConnection(id) || len(id) > 64 {
+		t.Errorf("invalid expiry connection id %q", id)
+	}
+	if id == newExpiryConnectionID() {
+		t.Errorf("expiry connection id %q reused", id)
+	}
+	if IsExpiryConnection(newConnectionID()) {
+		t.Error("connection of a client taken for an expiry connection")
+	}
+}
+
+func TestPlanExpiry(t *testing.T) {
+	stored := map[string]*reference.Ref{
+		"/a": {Path: "/a", Hash: "a"},
+		"/b": {Path: "/b", Hash: "b"},
+		"/c": {Path: "/c", Hash: "c2"}, // updated after its deletion was queued
+		"/d": {Path: "/d", Hash: "d"},
+	}
+	getRef := func(path string) *reference.Ref { return stored[path] }
+	expired := []*reference.Ref{stored["/a"], stored["/b"], stored["/c"], stored["/d"]}
+
+	expiryConnection := func(status int, deletes ...*DeleteFileChange) *AllocationChangeCollector {
+		conn := &AllocationChangeCollector{ConnectionID: newExpiryConnectionID(), Status: status}
+		for _, dfc := range deletes {
+			conn.AllocationChanges = append(conn.AllocationChanges, dfc)
+		}
+		return conn
+	}
+	paths := func(refs []*reference.Ref) []string {
+		var paths []string
+		for _, ref := range refs {
+			paths = append(paths, ref.Path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name        string
+		connections []*AllocationChangeCollector
+		stale       []int
+		queue       []string
+	}{
+		{
+			name:        "none queued",
+			connections: nil,
+			queue:       []string{"/a", "/b", "/c", "/d"},
+		},
+		{
+			name: "queued in an open connection",
+			connections: []*AllocationChangeCollector{
+				expiryConnection(InProgressConnection, &DeleteFileChange{Path: "/a", Hash: "a"}),
+			},
+			queue: []string{"/b", "/c", "/d"},
+		},
+		{
+			name: "committed",
+			connections: []*AllocationChangeCollector{
+				expiryConnection(CommittedConnection, &DeleteFileChange{Path: "/a", Hash: "a"}),
+			},
+			queue: []string{"/a", "/b", "/c", "/d"},
+		},
+		{
+			name: "deleted",
+			connections: []*AllocationChangeCollector{
+				expiryConnection(DeletedConnection, &DeleteFileChange{Path: "/a", Hash: "a"}),
+			},
+			queue: []string{"/a", "/b", "/c", "/d"},
+		},
+		{
+			name: "updated after queued",
+			connections: []*AllocationChangeCollector{
+				expiryConnection(InProgressConnection, &DeleteFileChange{Path: "/a", Hash: "a"},
+					&DeleteFileChange{Path: "/c", Hash: "c"}),
+				expiryConnection(InProgressConnection, &DeleteFileChange{Path: "/b", Hash: "b"}),
+			},
+			stale: []int{0},
+			queue: []string{"/a", "/c", "/d"},
+		},
+		{
+			name: "deleted after queued",
+			connections: []*AllocationChangeCollector{
+				expiryConnection(InProgressConnection, &DeleteFileChange{Path: "/gone", Hash: "g"}),
+			},
+			stale: []int{0},
+			queue: []string{"/a", "/b", "/c", "/d"},
+		},
+		{
+			name: "connection of the owner",
+			connections: []*AllocationChangeCollector{
+				{ConnectionID: newConnectionID(), Status: InProgressConnection,
+					AllocationChanges: []AllocationChangeProcessor{&DeleteFileChange{Path: "/a", Hash: "old"}}},
+			},
+			queue: []string{"/a", "/b", "/c", "/d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stale, queue := planExpiry(tt.connections, expired, getRef)
+			var expectedStale []*AllocationChangeCollector
+			for _, i := range tt.stale {
+				expectedStale = append(expectedStale, tt.connections[i])
+			}
+			if !reflect.DeepEqual(stale, expectedStale) {
+				t.Errorf("stale connections: %v, expected %v", stale, expectedStale)
+			}
+			if got := paths(queue); !reflect.DeepEqual(got, tt.queue) {
+				t.Errorf("queued: %v, expected %v", got, tt.queue)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package allocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// COMMIT_RETRY_INTERVAL is the interval at which the commits not finished
+// are retried.
+const COMMIT_RETRY_INTERVAL = time.Minute
+
+// CommitJournalEntry records a connection committed to the database whose
+// changes are still to be committed to the file store. It's added in the
+// transaction committing the connection and deleted once the files are in
+// place, so the entries left by a crash or a failure are the commits to
+// finish. The content released by the changes, known only once they're
+// applied, is journaled with them.
+type CommitJournalEntry struct {
+	ID              int64          `gorm:"column:id;primary_key"`
+	ConnectionID    string         `gorm:"column:connection_id"`
+	AllocationID    string         `gorm:"column:allocation_id"`
+	ReleasedContent datatypes.JSON `gorm:"column:released_content"`
+	CreatedAt       time.Time      `gorm:"column:created_at"`
+}
+
+func (CommitJournalEntry) TableName() string {
+	return "commit_journal"
+}
+
+// contentReleaser is a change releasing contents once committed.
+type contentReleaser interface {
+	releasedContentHashes() map[string]bool
+}
+
+func newCommitJournalEntry(cc *AllocationChangeCollector) (*CommitJournalEntry, error) {
+	released := make([]string, 0)
+	for _, change := range cc.AllocationChanges {
+		if releaser, ok := change.(contentReleaser); ok {
+			for contentHash := range releaser.releasedContentHashes() {
+				if len(contentHash) != 0 {
+					released = append(released, contentHash)
+				}
+			}
+		}
+	}
+	sort.Strings(released)
+	b, err := json.Marshal(released)
+	if err != nil {
+		return nil, err
+	}
+	return &CommitJournalEntry{
+		ConnectionID:    cc.ConnectionID,
+		AllocationID:    cc.AllocationID,
+		ReleasedContent: datatypes.JSON(b),
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+// releasedContent returns the content hashes journaled as released.
+func (entry *CommitJournalEntry) releasedContent() ([]string, error) {
+	var released []string
+	if len(entry.ReleasedContent) == 0 {
+		return released, nil
+	}
+	err := json.Unmarshal(entry.ReleasedContent, &released)
+	return released, err
+}
+
+// AddCommitJournalEntry journals the commit of the connection, in the
+// transaction committing it, once its changes are applied.
+func AddCommitJournalEntry(ctx context.Context, cc *AllocationChangeCollector) (*CommitJournalEntry, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	entry, err := newCommitJournalEntry(cc)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// FinishCommit commits the changes of the connection to the file store,
+// releases the content they no longer use, deletes their temp files and
+// deletes the journal entry, in a transaction of its own once the
+// connection is committed to the database. It should be called with the
+// allocation locked.
+func FinishCommit(ctx context.Context, entry *CommitJournalEntry, cc *AllocationChangeCollector) (err error) {
+	released, err := entry.releasedContent()
+	if err != nil {
+		return err
+	}
+
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+	var tx = datastore.GetStore().GetTransaction(ctx)
+	defer commit(tx, &err)
+
+	if err = cc.CommitToFileStore(ctx); err != nil {
+		return
+	}
+	for _, contentHash := range released {
+		ReleaseContent(ctx, cc.AllocationID, contentHash)
+	}
+	cc.DeleteChanges(ctx)
+	return tx.Delete(entry).Error
+}
+
+// RecoverCommits finishes the commits journaled but not finished, as left
+// by a crash between the database commit and the file store commit. A
+// commit not journaled was rolled back by the database before any file was
+// moved, its temp files are left to the client to commit again. The commits
+// it can't finish are reported and kept for the next try.
+func RecoverCommits(ctx context.Context) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	var entries []*CommitJournalEntry
+	err := db.Order("id").Find(&entries).Error
+	db.Rollback()
+	if err != nil {
+		Logger.Error("Error reading the commit journal", zap.Error(err))
+		return
+	}
+
+	unresolved := replayCommitJournal(entries, func(entry *CommitJournalEntry) error {
+		return recoverCommit(ctx, entry)
+	})
+	if len(entries) != 0 {
+		Logger.Info("Recovered the journaled commits", zap.Int("commits", len(entries)), zap.Int("unresolved", unresolved))
+	}
+}
+
+// CommitJournalWorker periodically retries the commits not finished, as
+// the ones whose file store commit failed.
+func CommitJournalWorker(ctx context.Context) {
+	var tk = time.NewTicker(COMMIT_RETRY_INTERVAL)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-tk.C:
+			RecoverCommits(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replayCommitJournal finishes the commits of the entries in order, going
+// on with the next ones when one fails, and returns the number of failures.
+func replayCommitJournal(entries []*CommitJournalEntry, finish func(entry *CommitJournalEntry) error) (unresolved int) {
+	for _, entry := range entries {
+		if err := finish(entry); err != nil {
+			Logger.Error("Unable to finish the commit of the connection",
+				zap.Any("allocation", entry.AllocationID), zap.Any("connection", entry.ConnectionID), zap.Error(err))
+			unresolved++
+			continue
+		}
+		Logger.Info("Finished the commit of the connection",
+			zap.Any("allocation", entry.AllocationID), zap.Any("connection", entry.ConnectionID))
+	}
+	return
+}
+
+// recoverCommit finishes the commit of the entry with the allocation locked,
+// unless it was finished meanwhile.
+func recoverCommit(ctx context.Context, entry *CommitJournalEntry) error {
+	var mutex = lock.GetMutex(Allocation{}.TableName(), entry.AllocationID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	defer db.Rollback()
+	err := db.Where("id = ?", entry.ID).First(entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cc := &AllocationChangeCollector{}
+	err = db.Where("connection_id = ?", entry.ConnectionID).Preload("Changes").First(cc).Error
+	if err != nil {
+		return err
+	}
+	cc.ComputeProperties()
+	return FinishCommit(ctx, entry, cc)
+}
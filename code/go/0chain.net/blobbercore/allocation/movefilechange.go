@@ -0,0 +1,134 @@
+package allocation
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"0chain.net/blobbercore/reference"
+	"0chain.net/blobbercore/stats"
+	"0chain.net/core/common"
+)
+
+// MoveFileChange moves a file or a directory, with its whole subtree, to
+// another directory. The refs are re-parented in place, the objects stay
+// as they are.
+type MoveFileChange struct {
+	ConnectionID string `json:"connection_id"`
+	AllocationID string `json:"allocation_id"`
+	SrcPath      string `json:"path"`
+	DestPath     string `json:"dest_path"`
+}
+
+func (mf *MoveFileChange) DeleteTempFile() error {
+	return OperationNotApplicable
+}
+
+func (mf *MoveFileChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
+	srcPath, destPath := filepath.Clean(mf.SrcPath), filepath.Clean(mf.DestPath)
+	if srcPath == "/" || destPath == srcPath || strings.HasPrefix(destPath, srcPath+"/") {
+		return nil, common.NewError("invalid_parameters", "Invalid destination path. Can't move a directory into itself.")
+	}
+
+	affectedRef, err := reference.GetObjectTree(ctx, mf.AllocationID, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	newPath := filepath.Join(destPath, affectedRef.Name)
+
+	// only the paths from the root to the source and to the destination
+	// are loaded, the hashes of the rest of the tree don't change
+	rootRef, err := reference.GetReferencePathFromPaths(ctx, mf.AllocationID, []string{srcPath, newPath})
+	if err != nil {
+		return nil, err
+	}
+
+	srcDirRef, err := findDirRef(rootRef, filepath.Dir(srcPath))
+	if err != nil {
+		return nil, err
+	}
+	idx := -1
+	for i, child := range srcDirRef.Children {
+		if child.Path == srcPath {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil, common.NewError("file_not_found", "Object to move not found in blobber")
+	}
+
+	destDirRef, err := findDirRef(rootRef, destPath)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid destination path. Should be a valid directory.")
+	}
+	for _, child := range destDirRef.Children {
+		if child.Path == newPath {
+			return nil, common.NewError("invalid_parameters", "Invalid destination path. Object Already exists.")
+		}
+	}
+
+	srcDirRef.RemoveChild(idx)
+	affectedRef.UpdatePath(newPath, destPath)
+	if affectedRef.Type == reference.FILE {
+		stats.FileUpdated(ctx, affectedRef.ID)
+	}
+	mf.processChildren(ctx, affectedRef)
+	destDirRef.AddChild(affectedRef)
+
+	_, err = rootRef.CalculateHash(ctx, true)
+	return rootRef, err
+}
+
+func (mf *MoveFileChange) processChildren(ctx context.Context, curRef *reference.Ref) {
+	for _, childRef := range curRef.Children {
+		newPath := filepath.Join(curRef.Path, childRef.Name)
+		childRef.UpdatePath(newPath, curRef.Path)
+		if childRef.Type == reference.FILE {
+			stats.FileUpdated(ctx, childRef.ID)
+		}
+		if childRef.Type == reference.DIRECTORY {
+			mf.processChildren(ctx, childRef)
+		}
+	}
+}
+
+// findDirRef returns the directory at the path in the reference path.
+func findDirRef(rootRef *reference.Ref, path string) (*reference.Ref, error) {
+	dirRef := rootRef
+	for _, name := range reference.GetSubDirsFromPath(path) {
+		var found *reference.Ref
+		for _, child := range dirRef.Children {
+			if child.Type == reference.DIRECTORY && child.Name == name {
+				found = child
+				break
+			}
+		}
+		if found == nil {
+			return nil, common.NewError("invalid_reference_path", "Invalid reference path from the blobber")
+		}
+		dirRef = found
+	}
+	if dirRef.Type != reference.DIRECTORY {
+		return nil, common.NewError("invalid_reference_path", "Invalid reference path from the blobber")
+	}
+	return dirRef, nil
+}
+
+func (mf *MoveFileChange) Marshal() (string, error) {
+	ret, err := json.Marshal(mf)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func (mf *MoveFileChange) Unmarshal(input string) error {
+	err := json.Unmarshal([]byte(input), mf)
+	return err
+}
+
+func (mf *MoveFileChange) CommitToFileStore(ctx context.Context) error {
+	return nil
+}
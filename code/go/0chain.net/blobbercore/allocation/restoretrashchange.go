@@ -0,0 +1,77 @@
+package allocation
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+)
+
+// RestoreTrashChange restores a file or a directory from the trash to its
+// original path or to a new one, creating the missing parent directories.
+type RestoreTrashChange struct {
+	ConnectionID string `json:"connection_id"`
+	AllocationID string `json:"allocation_id"`
+	EntryID      int64  `json:"entry_id"`
+	Path         string `json:"path"`
+}
+
+func (rt *RestoreTrashChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
+	entry, err := reference.GetTrashEntry(ctx, rt.AllocationID, rt.EntryID)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := reference.GetTrashedRefs(ctx, entry)
+	if err != nil {
+		return nil, common.NewError("trash_error", "Error reading the trashed refs. "+err.Error())
+	}
+
+	rootRef, err := reference.GetReferencePath(ctx, rt.AllocationID, rt.Path)
+	if err != nil {
+		return nil, err
+	}
+	dirRef, err := makeDirs(rootRef, filepath.Dir(rt.Path))
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range dirRef.Children {
+		if child.Path == rt.Path {
+			return nil, common.NewError("invalid_parameters", "Invalid path. Object Already exists.")
+		}
+	}
+
+	restoredRef, err := reference.RestoreTrashedRefs(refs, entry.Path, rt.Path)
+	if err != nil {
+		return nil, err
+	}
+	dirRef.AddChild(restoredRef)
+	if err = reference.DeleteTrashEntry(ctx, entry); err != nil {
+		return nil, common.NewError("trash_error", "Error deleting the trash entry. "+err.Error())
+	}
+
+	_, err = rootRef.CalculateHash(ctx, true)
+	return rootRef, err
+}
+
+func (rt *RestoreTrashChange) Marshal() (string, error) {
+	ret, err := json.Marshal(rt)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func (rt *RestoreTrashChange) Unmarshal(input string) error {
+	err := json.Unmarshal([]byte(input), rt)
+	return err
+}
+
+func (rt *RestoreTrashChange) DeleteTempFile() error {
+	return OperationNotApplicable
+}
+
+func (rt *RestoreTrashChange) CommitToFileStore(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package allocation
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"0chain.net/blobbercore/reference"
+	"0chain.net/blobbercore/stats"
+	"0chain.net/core/common"
+)
+
+// RestoreVersionChange makes a version kept for a file its current content.
+// The current content is kept as the latest version if versioning is still
+// enabled for the file.
+type RestoreVersionChange struct {
+	ConnectionID string `json:"connection_id"`
+	AllocationID string `json:"allocation_id"`
+	Path         string `json:"path"`
+	Version      int64  `json:"version"`
+	// contents no longer used by the file, journaled with the commit
+	releasedContent map[string]bool
+}
+
+func (rv *RestoreVersionChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
+	rootRef, err := reference.GetReferencePath(ctx, rv.AllocationID, rv.Path)
+	if err != nil {
+		return nil, err
+	}
+	dirRef, err := findDirRef(rootRef, filepath.Dir(rv.Path))
+	if err != nil {
+		return nil, err
+	}
+	var fileRef *reference.Ref
+	for _, child := range dirRef.Children {
+		if child.Type == reference.FILE && child.Path == rv.Path {
+			fileRef = child
+			break
+		}
+	}
+	if fileRef == nil {
+		return nil, common.NewError("file_not_found", "File to restore not found in blobber")
+	}
+
+	version, err := reference.GetFileVersion(ctx, fileRef.ID, rv.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err = reference.DeleteFileVersion(ctx, version); err != nil {
+		return nil, common.NewError("file_version_error", "Error deleting the restored version. "+err.Error())
+	}
+	if err = AddUsedSize(ctx, rv.AllocationID, -version.Size); err != nil {
+		return nil, common.NewError("file_version_error", "Error updating the allocation size. "+err.Error())
+	}
+	rv.releasedContent, err = retainVersion(ctx, rootRef, fileRef)
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range version.ContentHashes() {
+		delete(rv.releasedContent, hash)
+	}
+
+	fileRef.ContentHash = version.ContentHash
+	fileRef.MerkleRoot = version.MerkleRoot
+	fileRef.Size = version.Size
+	fileRef.ActualFileSize = version.ActualFileSize
+	fileRef.ActualFileHash = version.ActualFileHash
+	fileRef.MimeType = version.MimeType
+	fileRef.CustomMeta = version.CustomMeta
+	fileRef.ThumbnailSize = version.ThumbnailSize
+	fileRef.ThumbnailHash = version.ThumbnailHash
+	fileRef.ActualThumbnailSize = version.ActualThumbnailSize
+	fileRef.ActualThumbnailHash = version.ActualThumbnailHash
+	fileRef.EncryptedKey = version.EncryptedKey
+	fileRef.OnCloud = version.OnCloud
+	fileRef.WriteMarker = allocationRoot
+
+	_, err = rootRef.CalculateHash(ctx, true)
+	stats.FileUpdated(ctx, fileRef.ID)
+	return rootRef, err
+}
+
+func (rv *RestoreVersionChange) Marshal() (string, error) {
+	ret, err := json.Marshal(rv)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func (rv *RestoreVersionChange) Unmarshal(input string) error {
+	err := json.Unmarshal([]byte(input), rv)
+	return err
+}
+
+func (rv *RestoreVersionChange) DeleteTempFile() error {
+	return OperationNotApplicable
+}
+
+// CommitToFileStore has nothing to commit, the content released is
+// journaled with the commit.
+func (rv *RestoreVersionChange) CommitToFileStore(ctx context.Context) error {
+	return nil
+}
+
+func (rv *RestoreVersionChange) releasedContentHashes() map[string]bool {
+	return rv.releasedContent
+}
@@ -0,0 +1,78 @@
+package allocation
+
+import (
+	"context"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+)
+
+// PurgeTrashEntries deletes the trash entries for good in a transaction of
+// their own, all or none of them. The content of their files and of their
+// versions is released once the transaction is committed, not to delete
+// objects still used if it fails. It should be called with the allocation
+// locked.
+func PurgeTrashEntries(ctx context.Context, allocationID string, entries []*reference.TrashEntry) error {
+	pctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(pctx)
+	released := make(map[string]bool)
+	for _, entry := range entries {
+		if err := purgeTrashEntry(pctx, entry, released); err != nil {
+			db.Rollback()
+			return err
+		}
+	}
+	if err := db.Commit().Error; err != nil {
+		return common.NewError("trash_error", "Error committing the purge of the trash. "+err.Error())
+	}
+
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	defer datastore.GetStore().GetTransaction(rctx).Rollback()
+	for contentHash := range released {
+		if len(contentHash) != 0 {
+			ReleaseContent(rctx, allocationID, contentHash)
+		}
+	}
+	return nil
+}
+
+// purgeTrashEntry deletes the trash entry, adding the content hashes of its
+// files and of their versions to the released ones.
+func purgeTrashEntry(ctx context.Context, entry *reference.TrashEntry, released map[string]bool) error {
+	refs, err := reference.GetTrashedRefs(ctx, entry)
+	if err != nil {
+		return common.NewError("trash_error", "Error reading the trashed refs. "+err.Error())
+	}
+	if err = reference.DeleteTrashEntry(ctx, entry); err != nil {
+		return common.NewError("trash_error", "Error deleting the trash entry. "+err.Error())
+	}
+	for contentHash := range trashedContent(refs) {
+		released[contentHash] = true
+	}
+	for _, ref := range refs {
+		if ref.Type != reference.FILE {
+			continue
+		}
+		if err = deleteFileVersions(ctx, ref, released); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashedContent returns the content hashes of the files of the trashed
+// refs, their thumbnails included.
+func trashedContent(refs []*reference.Ref) map[string]bool {
+	content := make(map[string]bool)
+	for _, ref := range refs {
+		if ref.Type != reference.FILE {
+			continue
+		}
+		content[ref.ContentHash] = true
+		if len(ref.ThumbnailHash) != 0 {
+			content[ref.ThumbnailHash] = true
+		}
+	}
+	return content
+}
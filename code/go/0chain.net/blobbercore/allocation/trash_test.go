@@ -0,0 +1,21 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+
+	"0chain.net/blobbercore/reference"
+)
+
+func TestTrashedContent(t *testing.T) {
+	refs := []*reference.Ref{
+		{Type: reference.DIRECTORY, Path: "/dir", Hash: "d"},
+		{Type: reference.FILE, Path: "/dir/a", ContentHash: "a", ThumbnailHash: "ta"},
+		{Type: reference.FILE, Path: "/dir/b", ContentHash: "b"},
+		{Type: reference.FILE, Path: "/dir/c", ContentHash: "a"},
+	}
+	expected := map[string]bool{"a": true, "ta": true, "b": true}
+	if content := trashedContent(refs); !reflect.DeepEqual(content, expected) {
+		t.Errorf("trashed content: %v, expected %v", content, expected)
+	}
+}
@@ -17,6 +17,8 @@ import (
 
 type UpdateFileChange struct {
 	NewFileChange
+	// contents no longer used by the file, journaled with the commit
+	releasedContent map[string]bool
 }
 
 func (nf *UpdateFileChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
@@ -61,6 +63,10 @@ func (nf *UpdateFileChange) ProcessChange(ctx context.Context, change *Allocatio
 		return nil, common.NewError("file_not_found", "File to update not found in blobber")
 	}
 	existingRef := dirRef.Children[idx]
+	nf.releasedContent, err = retainVersion(ctx, rootRef, existingRef)
+	if err != nil {
+		return nil, err
+	}
 	existingRef.ActualFileHash = nf.ActualHash
 	existingRef.ActualFileSize = nf.ActualSize
 	existingRef.MimeType = nf.MimeType
@@ -135,3 +141,57 @@ func (nfch *UpdateFileChange) CommitToFileStore(ctx context.Context) error {
 	}
 	return nil
 }
+
+func (nfch *UpdateFileChange) releasedContentHashes() map[string]bool {
+	return nfch.releasedContent
+}
+
+// retainVersion keeps the current content of the file as its latest version
+// if versioning is enabled for it, and prunes the versions beyond the number
+// to keep. The retained bytes are accounted in the used size of the
+// allocation. It returns the contents no longer used by the file, to be
+// released once the change is committed.
+func retainVersion(ctx context.Context, rootRef *reference.Ref, fileRef *reference.Ref) (map[string]bool, error) {
+	keep := reference.GetKeepVersions(rootRef, fileRef.Path)
+	var version *reference.FileVersion
+	if keep > 0 {
+		var err error
+		version, err = reference.AddFileVersion(ctx, fileRef)
+		if err != nil {
+			return nil, common.NewError("file_version_error", "Error keeping the file version. "+err.Error())
+		}
+	}
+	pruned, err := reference.PruneFileVersions(ctx, fileRef.ID, keep)
+	if err != nil {
+		return nil, common.NewError("file_version_error", "Error pruning the file versions. "+err.Error())
+	}
+	retainedSize, released := versionRetention(fileRef, version, pruned)
+	if err = AddUsedSize(ctx, fileRef.AllocationID, retainedSize); err != nil {
+		return nil, common.NewError("file_version_error", "Error updating the allocation size. "+err.Error())
+	}
+	return released, nil
+}
+
+// versionRetention returns the bytes retained by keeping the version of the
+// file, released if negative, and the contents released. The content of the
+// file is released if no version is kept, as the contents of the pruned
+// versions are.
+func versionRetention(fileRef *reference.Ref, version *reference.FileVersion, pruned []*reference.FileVersion) (int64, map[string]bool) {
+	released := make(map[string]bool)
+	var retainedSize int64
+	if version != nil {
+		retainedSize += version.Size
+	} else {
+		released[fileRef.ContentHash] = true
+		if len(fileRef.ThumbnailHash) != 0 {
+			released[fileRef.ThumbnailHash] = true
+		}
+	}
+	for _, version := range pruned {
+		retainedSize -= version.Size
+		for _, hash := range version.ContentHashes() {
+			released[hash] = true
+		}
+	}
+	return retainedSize, released
+}
@@ -0,0 +1,37 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+
+	"0chain.net/blobbercore/reference"
+)
+
+func TestVersionRetention(t *testing.T) {
+	fileRef := &reference.Ref{ContentHash: "c", ThumbnailHash: "t", Size: 100}
+	pruned := []*reference.FileVersion{
+		{ContentHash: "c1", ThumbnailHash: "t1", Size: 30},
+		{ContentHash: "c2", Size: 20},
+	}
+
+	size, released := versionRetention(fileRef, &reference.FileVersion{ContentHash: "c", ThumbnailHash: "t", Size: 100}, pruned)
+	if size != 50 {
+		t.Errorf("retained size with a version kept: %d, expected 50", size)
+	}
+	if expected := map[string]bool{"c1": true, "t1": true, "c2": true}; !reflect.DeepEqual(released, expected) {
+		t.Errorf("released with a version kept: %v, expected %v", released, expected)
+	}
+
+	size, released = versionRetention(fileRef, nil, pruned)
+	if size != -50 {
+		t.Errorf("retained size without a version kept: %d, expected -50", size)
+	}
+	if expected := map[string]bool{"c": true, "t": true, "c1": true, "t1": true, "c2": true}; !reflect.DeepEqual(released, expected) {
+		t.Errorf("released without a version kept: %v, expected %v", released, expected)
+	}
+
+	size, released = versionRetention(&reference.Ref{ContentHash: "c"}, nil, nil)
+	if size != 0 || !reflect.DeepEqual(released, map[string]bool{"c": true}) {
+		t.Errorf("unversioned file: %d, %v", size, released)
+	}
+}
@@ -0,0 +1,84 @@
+package allocation
+
+import (
+	"context"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/encryption"
+)
+
+const (
+	UploadSessionOpen      = 0
+	UploadSessionFinalized = 1
+	UploadSessionDeleted   = 2
+)
+
+// UploadSession tracks a file uploaded in chunks within a connection. The
+// chunks are appended to the temporary file of the connection and the file
+// becomes an insert or update change of the connection once finalized.
+type UploadSession struct {
+	SessionID    string `gorm:"column:session_id;primary_key" json:"session_id"`
+	ConnectionID string `gorm:"column:connection_id" json:"connection_id"`
+	AllocationID string `gorm:"column:allocation_id" json:"allocation_id"`
+	ClientID     string `gorm:"column:client_id" json:"-"`
+	Operation    string `gorm:"column:operation" json:"operation"`
+	Path         string `gorm:"column:path" json:"path"`
+	Filename     string `gorm:"column:filename" json:"filename"`
+	UploadMeta   string `gorm:"column:upload_meta" json:"-"`
+	UploadedSize int64  `gorm:"column:uploaded_size" json:"uploaded_size"`
+	Status       int    `gorm:"column:status" json:"status"`
+	datastore.ModelWithTS
+}
+
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
+
+// GetUploadSessionID returns the session id of a file uploaded within the
+// connection, reopening a session for the same path resumes it.
+func GetUploadSessionID(connectionID, path string) string {
+	return encryption.Hash(connectionID + ":" + path)
+}
+
+// GetUploadSession returns an open or finalized session of the client.
+func GetUploadSession(ctx context.Context, sessionID, allocationID,
+	clientID string) (*UploadSession, error) {
+
+	var (
+		db = datastore.GetStore().GetTransaction(ctx)
+		us = &UploadSession{}
+	)
+	err := db.Where(&UploadSession{
+		SessionID:    sessionID,
+		AllocationID: allocationID,
+		ClientID:     clientID,
+	}).Where("status <> ?", UploadSessionDeleted).First(us).Error
+	if err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+// GetOpenUploadSessions returns the sessions of the connection
+// not finalized yet.
+func GetOpenUploadSessions(ctx context.Context, connectionID string) (
+	sessions []*UploadSession, err error) {
+
+	var db = datastore.GetStore().GetTransaction(ctx)
+	err = db.Where("connection_id = ? AND status = ?", connectionID,
+		UploadSessionOpen).Find(&sessions).Error
+	return
+}
+
+// Save saves the session, touching its connection to keep the connection
+// open while chunks are being uploaded.
+func (us *UploadSession) Save(ctx context.Context) error {
+	var db = datastore.GetStore().GetTransaction(ctx)
+	err := db.Model(&AllocationChangeCollector{}).
+		Where("connection_id = ?", us.ConnectionID).
+		Update("status", InProgressConnection).Error
+	if err != nil {
+		return err
+	}
+	return db.Save(us).Error
+}
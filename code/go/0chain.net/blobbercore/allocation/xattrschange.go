@@ -0,0 +1,93 @@
+package allocation
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"0chain.net/blobbercore/reference"
+	"0chain.net/blobbercore/stats"
+	"0chain.net/core/common"
+)
+
+// XAttrsChange sets and removes user key/value metadata of a file or a
+// directory. The xattrs are part of the hash of the ref.
+type XAttrsChange struct {
+	ConnectionID string            `json:"connection_id"`
+	AllocationID string            `json:"allocation_id"`
+	Path         string            `json:"path"`
+	Set          map[string]string `json:"set,omitempty"`
+	Remove       []string          `json:"remove,omitempty"`
+}
+
+func (xc *XAttrsChange) ProcessChange(ctx context.Context, change *AllocationChange, allocationRoot string) (*reference.Ref, error) {
+	rootRef, err := reference.GetReferencePath(ctx, xc.AllocationID, xc.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var existingRef *reference.Ref
+	if xc.Path == "/" {
+		existingRef = rootRef
+	} else {
+		dirRef, err := findDirRef(rootRef, filepath.Dir(xc.Path))
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range dirRef.Children {
+			if child.Path == xc.Path {
+				existingRef = child
+				break
+			}
+		}
+	}
+	if existingRef == nil {
+		return nil, common.NewError("file_not_found", "Object to update not found in blobber")
+	}
+
+	xattrs, err := existingRef.GetXAttrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range xc.Remove {
+		delete(xattrs, key)
+	}
+	for key, value := range xc.Set {
+		xattrs[key] = value
+	}
+	if err = existingRef.SetXAttrs(xattrs); err != nil {
+		return nil, err
+	}
+	if existingRef.Type == reference.FILE {
+		existingRef.WriteMarker = allocationRoot
+	}
+
+	if _, err = rootRef.CalculateHash(ctx, true); err != nil {
+		return nil, err
+	}
+	if existingRef.Type == reference.FILE {
+		stats.FileUpdated(ctx, existingRef.ID)
+	}
+	return rootRef, nil
+}
+
+func (xc *XAttrsChange) Marshal() (string, error) {
+	ret, err := json.Marshal(xc)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func (xc *XAttrsChange) Unmarshal(input string) error {
+	err := json.Unmarshal([]byte(input), xc)
+	return err
+}
+
+func (xc *XAttrsChange) DeleteTempFile() error {
+	return OperationNotApplicable
+}
+
+func (xc *XAttrsChange) CommitToFileStore(ctx context.Context) error {
+	return nil
+}
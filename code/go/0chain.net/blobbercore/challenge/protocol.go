@@ -135,6 +135,7 @@ func (cr *ChallengeEntity) GetValidationTickets(ctx context.Context) error {
 		inputData.Name = objectPath.Meta["name"].(string)
 		inputData.Path = objectPath.Meta["path"].(string)
 		inputData.Hash = objectPath.Meta["content_hash"].(string)
+		inputData.OnCloud, _ = objectPath.Meta["on_cloud"].(bool)
 		r := rand.New(rand.NewSource(cr.RandomNumber))
 		//rand.Seed(cr.RandomNumber)
 		blockoffset := r.Intn(1024)
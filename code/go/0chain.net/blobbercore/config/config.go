@@ -24,6 +24,16 @@ func SetupDefaultConfig() {
 	viper.SetDefault("challenge_response.frequency", 10)
 	viper.SetDefault("challenge_response.num_workers", 5)
 	viper.SetDefault("challenge_response.max_retries", 10)
+	viper.SetDefault("scrub.enabled", false)
+	viper.SetDefault("scrub.frequency", 86400)
+	viper.SetDefault("scrub.bytes_per_second", 10485760)
+	viper.SetDefault("scrub.restore_from_cloud", false)
+	viper.SetDefault("compression.enabled", false)
+	viper.SetDefault("compression.level", -1)
+	viper.SetDefault("trash.retention_period", 0)
+	viper.SetDefault("trash.frequency", 3600)
+	viper.SetDefault("expiry.frequency", 300)
+	viper.SetDefault("history.num_write_markers", 100)
 
 	viper.SetDefault("capacity", -1)
 	viper.SetDefault("read_price", 0.0)
@@ -91,11 +101,41 @@ type Config struct {
 	ColdStorageStartCapacitySize int64
 	ColdStorageDeleteLocalCopy   bool
 	ColdStorageDeleteCloudCopy   bool
+	ColdStorageTier              string
+	ColdStorageLocalPath         string
+	ColdStoragePromoteAfterReads int64
+	ColdStorageCacheSize         int64
 
 	MinioStart      bool
 	MinioWorkerFreq int64
 	MinioUseSSL     bool
 
+	// EncryptionAtRestKeyFile is the file of the master key wrapping the
+	// data keys of allocations, encryption at rest is disabled if empty.
+	EncryptionAtRestKeyFile string
+
+	CompressionEnabled bool
+	CompressionLevel   int // compress/flate level
+
+	ScrubEnabled          bool
+	ScrubFreq             int64
+	ScrubBytesPerSecond   int64
+	ScrubRestoreFromCloud bool
+
+	// TrashRetentionPeriod is the number of seconds deleted files are kept
+	// in the trash, they are deleted at once if zero.
+	TrashRetentionPeriod int64
+	TrashWorkerFreq      int64
+
+	// ExpiryWorkerFreq is the number of seconds between the queueings of
+	// the deletions of the files past their expires_at attribute, committed
+	// by the owner.
+	ExpiryWorkerFreq int64
+
+	// HistoryWriteMarkers is the number of latest write markers of an
+	// allocation the refs can be read as of, all of them if zero.
+	HistoryWriteMarkers int
+
 	ReadPrice               float64
 	WritePrice              float64
 	PriceInUSD              bool
@@ -123,6 +163,22 @@ type Config struct {
 /*Configuration of the system */
 var Configuration Config
 
+// Cold storage tiers
+const (
+	ColdTierMinio = "minio"
+	ColdTierLocal = "local"
+)
+
+// ColdStorageEnabled - is cold data moved off the local disk to a cold tier
+func ColdStorageEnabled() bool {
+	return len(Configuration.ColdStorageTier) != 0
+}
+
+// EncryptionAtRestEnabled - are files encrypted on disk and on the cold tier
+func EncryptionAtRestEnabled() bool {
+	return len(Configuration.EncryptionAtRestKeyFile) != 0
+}
+
 /*TestNet is the program running in TestNet mode? */
 func TestNet() bool {
 	return Configuration.DeploymentMode == DeploymentTestNet
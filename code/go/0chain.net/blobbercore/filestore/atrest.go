@@ -0,0 +1,304 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"0chain.net/core/common"
+	"0chain.net/core/encryption"
+	"0chain.net/core/lock"
+)
+
+// Encryption at rest. Every allocation has its own random data key, stored
+// in the allocation directory wrapped by the master key of the blobber. The
+// files of the allocation are encrypted with AES-CTR under the data key and
+// a random IV kept in the file header, so any range of a file can be read
+// and written without touching the rest of it.
+const (
+	DataKeyFileName = "datakey"
+
+	encryptedFileMagic  = "0CHNENC1"
+	encryptedHeaderSize = int64(len(encryptedFileMagic) + aes.BlockSize)
+	dataKeySize         = 32
+)
+
+// loadMasterKey reads the hex encoded 256 bit master key from the key file.
+func loadMasterKey(keyFile string) (cipher.AEAD, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, common.NewError("invalid_master_key", "Master key is not hex encoded. "+err.Error())
+	}
+	if len(key) != dataKeySize {
+		return nil, common.NewErrorf("invalid_master_key", "Master key must be %d bytes long", dataKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionAtRest tells whether the files of allocations are encrypted.
+func (fs *FileFSStore) EncryptionAtRest() bool {
+	return fs.masterKey != nil
+}
+
+// getDataKey returns the cipher of the data key of the allocation, creating
+// the data key on the first write.
+func (fs *FileFSStore) getDataKey(allocation *StoreAllocation, create bool) (cipher.Block, error) {
+	if block, ok := fs.dataKeys.Load(allocation.ID); ok {
+		return block.(cipher.Block), nil
+	}
+	if fs.masterKey == nil {
+		return nil, common.NewError("encryption_key_missing", "File is encrypted but no master key is configured")
+	}
+
+	mutex := lock.GetMutex(DataKeyFileName, allocation.ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	keyPath := filepath.Join(allocation.Path, DataKeyFileName)
+	key, err := fs.readDataKey(allocation, keyPath)
+	if os.IsNotExist(err) && create {
+		key, err = fs.writeDataKey(allocation, keyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	fs.dataKeys.Store(allocation.ID, block)
+	return block, nil
+}
+
+func (fs *FileFSStore) readDataKey(allocation *StoreAllocation, keyPath string) ([]byte, error) {
+	wrapped, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := fs.masterKey.NonceSize()
+	if len(wrapped) < nonceSize {
+		return nil, common.NewError("invalid_data_key", "Data key of the allocation is corrupt")
+	}
+	key, err := fs.masterKey.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], []byte(allocation.ID))
+	if err != nil {
+		return nil, common.NewError("invalid_data_key", "Unable to unwrap the data key of the allocation. "+err.Error())
+	}
+	return key, nil
+}
+
+func (fs *FileFSStore) writeDataKey(allocation *StoreAllocation, keyPath string) ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	nonce := make([]byte, fs.masterKey.NonceSize())
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	wrapped := fs.masterKey.Seal(nonce, nonce, key, []byte(allocation.ID))
+	if err := createDirs(allocation.Path); err != nil {
+		return nil, err
+	}
+	tmpPath := keyPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, wrapped, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, keyPath); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// contentKey returns the key a content is stored under in the content store
+// and the cold tier. Encrypted contents can't be shared by allocations, so
+// they are deduplicated within their allocation only.
+func (fs *FileFSStore) contentKey(allocationID string, hash string) string {
+	if fs.EncryptionAtRest() {
+		return encryption.Hash(allocationID + ":" + hash)
+	}
+	return hash
+}
+
+// objectFile is a file of the store accessed as plaintext, whether it's
+// stored encrypted or not.
+type objectFile interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Size() (int64, error)
+	Truncate(size int64) error
+}
+
+type plainFile struct {
+	*os.File
+}
+
+func (pf *plainFile) Size() (int64, error) {
+	info, err := pf.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+type encryptedFile struct {
+	file  *os.File
+	block cipher.Block
+	iv    []byte
+}
+
+// xorKeyStream encrypts or decrypts the data at the offset of the file.
+func (ef *encryptedFile) xorKeyStream(data []byte, offset int64) {
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, ef.iv)
+	// add the block number to the low 64 bits of the IV, carrying over
+	blockNum := uint64(offset / aes.BlockSize)
+	low := binary.BigEndian.Uint64(counter[8:])
+	binary.BigEndian.PutUint64(counter[8:], low+blockNum)
+	if low+blockNum < low {
+		high := binary.BigEndian.Uint64(counter[:8])
+		binary.BigEndian.PutUint64(counter[:8], high+1)
+	}
+	stream := cipher.NewCTR(ef.block, counter)
+	if skip := offset % aes.BlockSize; skip != 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	stream.XORKeyStream(data, data)
+}
+
+func (ef *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := ef.file.ReadAt(p, off+encryptedHeaderSize)
+	ef.xorKeyStream(p[:n], off)
+	return n, err
+}
+
+func (ef *encryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	ef.xorKeyStream(buf, off)
+	return ef.file.WriteAt(buf, off+encryptedHeaderSize)
+}
+
+func (ef *encryptedFile) Size() (int64, error) {
+	info, err := ef.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size() - encryptedHeaderSize, nil
+}
+
+func (ef *encryptedFile) Truncate(size int64) error {
+	return ef.file.Truncate(size + encryptedHeaderSize)
+}
+
+func (ef *encryptedFile) Close() error {
+	return ef.file.Close()
+}
+
+// openObjectFile opens a file of the allocation, decrypting it if it has
+// been stored encrypted. Files stored before encryption at rest has been
+// enabled are read as they are, and all files are while it's disabled, so
+// content starting like an encrypted file isn't mistaken for one. Files
+// opened read only are committed objects, which may also be compressed.
+func (fs *FileFSStore) openObjectFile(allocation *StoreAllocation, path string, flag int) (objectFile, error) {
+	file, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if !fs.EncryptionAtRest() {
+		return fs.openCommittedObject(&plainFile{file}, flag)
+	}
+	header := make([]byte, encryptedHeaderSize)
+	n, err := file.ReadAt(header, 0)
+	if int64(n) < encryptedHeaderSize || !bytes.Equal(header[:len(encryptedFileMagic)], []byte(encryptedFileMagic)) {
+		if err != nil && err != io.EOF {
+			file.Close()
+			return nil, err
+		}
+		return fs.openCommittedObject(&plainFile{file}, flag)
+	}
+	block, err := fs.getDataKey(allocation, false)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return fs.openCommittedObject(&encryptedFile{file: file, block: block, iv: header[len(encryptedFileMagic):]}, flag)
+}
+
+// openCommittedObject decompresses the content of committed objects.
+func (fs *FileFSStore) openCommittedObject(file objectFile, flag int) (objectFile, error) {
+	if flag != os.O_RDONLY {
+		return file, nil
+	}
+	cf, err := openCompressedFile(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return cf, nil
+}
+
+// createObjectFile creates, or truncates, a file of the allocation to be
+// written, encrypted if encryption at rest is enabled.
+func (fs *FileFSStore) createObjectFile(allocation *StoreAllocation, path string) (objectFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if !fs.EncryptionAtRest() {
+		return &plainFile{file}, nil
+	}
+	block, err := fs.getDataKey(allocation, true)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	header := make([]byte, encryptedHeaderSize)
+	copy(header, encryptedFileMagic)
+	if _, err = rand.Read(header[len(encryptedFileMagic):]); err == nil {
+		_, err = file.WriteAt(header, 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &encryptedFile{file: file, block: block, iv: header[len(encryptedFileMagic):]}, nil
+}
+
+// newObjectFileReader returns a reader of the whole content of the file.
+func newObjectFileReader(file objectFile) (*io.SectionReader, error) {
+	size, err := file.Size()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(file, 0, size), nil
+}
+
+// objectFileWriter writes to the file sequentially from an offset.
+type objectFileWriter struct {
+	file   objectFile
+	offset int64
+}
+
+func (ow *objectFileWriter) Write(p []byte) (int, error) {
+	n, err := ow.file.WriteAt(p, ow.offset)
+	ow.offset += int64(n)
+	return n, err
+}
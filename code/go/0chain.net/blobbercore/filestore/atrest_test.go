@@ -0,0 +1,128 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"0chain.net/core/encryption"
+)
+
+func newTestMasterKey(t *testing.T) cipher.AEAD {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	masterKey, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return masterKey
+}
+
+func TestEncryptionAtRest(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "atrest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	masterKey := newTestMasterKey(t)
+	fs := &FileFSStore{RootDirectory: rootDir, masterKey: masterKey}
+	allocation, err := fs.SetupAllocation(encryption.Hash("alloc"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 3*CHUNK_SIZE+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	path := filepath.Join(allocation.TempObjectsPath, "object")
+	file, err := fs.createObjectFile(allocation, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// write out of order, as chunks of a resumed upload may be
+	w := &objectFileWriter{file: file, offset: 1000}
+	if _, err = w.Write(data[1000:]); err != nil {
+		t.Fatal(err)
+	}
+	w = &objectFileWriter{file: file}
+	if _, err = w.Write(data[:1000]); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(raw)) != int64(len(data))+encryptedHeaderSize || bytes.Contains(raw, data[:64]) {
+		t.Fatal("file is not stored encrypted")
+	}
+
+	// a new store has to unwrap the data key of the allocation
+	fs = &FileFSStore{RootDirectory: rootDir, masterKey: masterKey}
+	file, err = fs.openObjectFile(allocation, path, os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	size, err := file.Size()
+	if err != nil || size != int64(len(data)) {
+		t.Fatalf("got size %d (%v), want %d", size, err, len(data))
+	}
+	for _, off := range []int64{0, 17, CHUNK_SIZE - 5, 2*CHUNK_SIZE + 33} {
+		buf := make([]byte, 100)
+		if _, err = file.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data[off:off+100]) {
+			t.Errorf("wrong plaintext read at offset %d", off)
+		}
+	}
+
+	// the data key can't be unwrapped with another master key
+	fs = &FileFSStore{RootDirectory: rootDir, masterKey: newTestMasterKey(t)}
+	if _, err = fs.openObjectFile(allocation, path, os.O_RDONLY); err == nil {
+		t.Error("expected error opening a file with the wrong master key")
+	}
+}
+
+func TestOpenObjectFileWithoutEncryption(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "atrest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	fs := &FileFSStore{RootDirectory: rootDir}
+	allocation, err := fs.SetupAllocation(encryption.Hash("alloc"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// content looking like an encrypted file is read as it is
+	data := append([]byte(encryptedFileMagic), make([]byte, 2*encryptedHeaderSize)...)
+	path := filepath.Join(allocation.TempObjectsPath, "object")
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := fs.openObjectFile(allocation, path, os.O_RDWR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if size, err := file.Size(); err != nil || size != int64(len(data)) {
+		t.Errorf("got size %d (%v), want %d", size, err, len(data))
+	}
+}
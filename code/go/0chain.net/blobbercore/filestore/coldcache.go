@@ -0,0 +1,133 @@
+package filestore
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+const ColdCacheDirName = "coldcache"
+
+type coldCacheEntry struct {
+	key  string
+	path string
+	size int64
+}
+
+// coldCache keeps the contents last fetched from the cold tier on the local
+// disk, up to maxSize bytes, so repeated reads of a cold file don't download
+// it again. Contents are evicted least recently opened first, and a content
+// is downloaded once however many reads wait for it.
+type coldCache struct {
+	dir     string
+	maxSize int64
+
+	mutex    sync.Mutex
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List
+	fetching map[string]chan struct{}
+}
+
+// newColdCache returns a cache in the directory, emptied of the contents
+// cached before a restart.
+func newColdCache(dir string, maxSize int64) (*coldCache, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := createDirs(dir); err != nil {
+		return nil, err
+	}
+	return &coldCache{
+		dir:      dir,
+		maxSize:  maxSize,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		fetching: make(map[string]chan struct{}),
+	}, nil
+}
+
+// open opens the cached content with the key, fetching it to the file path
+// passed to fetch first if it isn't cached. The content is opened before it
+// can be evicted, evicted contents stay readable by the files opened.
+func (cc *coldCache) open(key string, fetch func(path string) error,
+	open func(path string) (objectFile, error)) (objectFile, error) {
+
+	cc.mutex.Lock()
+	for {
+		if elem, ok := cc.entries[key]; ok {
+			defer cc.mutex.Unlock()
+			cc.lru.MoveToFront(elem)
+			return open(elem.Value.(*coldCacheEntry).path)
+		}
+		done, ok := cc.fetching[key]
+		if !ok {
+			break
+		}
+		cc.mutex.Unlock()
+		<-done
+		cc.mutex.Lock()
+	}
+	done := make(chan struct{})
+	cc.fetching[key] = done
+	cc.mutex.Unlock()
+
+	entry, err := cc.fetch(key, fetch)
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	delete(cc.fetching, key)
+	close(done)
+	if err != nil {
+		return nil, err
+	}
+	cc.entries[key] = cc.lru.PushFront(entry)
+	cc.size += entry.size
+	file, err := open(entry.path)
+	cc.evict()
+	return file, err
+}
+
+func (cc *coldCache) fetch(key string, fetch func(path string) error) (*coldCacheEntry, error) {
+	tempFile, err := ioutil.TempFile(cc.dir, "cold-")
+	if err != nil {
+		return nil, err
+	}
+	tempFile.Close()
+	if err = fetch(tempFile.Name()); err != nil {
+		os.Remove(tempFile.Name())
+		return nil, err
+	}
+	info, err := os.Stat(tempFile.Name())
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return nil, err
+	}
+	return &coldCacheEntry{key: key, path: tempFile.Name(), size: info.Size()}, nil
+}
+
+// evict removes the least recently opened contents until the cache fits in
+// its size, a content larger than the cache included.
+func (cc *coldCache) evict() {
+	for cc.size > cc.maxSize && cc.lru.Len() != 0 {
+		cc.remove(cc.lru.Back())
+	}
+}
+
+func (cc *coldCache) remove(elem *list.Element) {
+	entry := cc.lru.Remove(elem).(*coldCacheEntry)
+	delete(cc.entries, entry.key)
+	cc.size -= entry.size
+	os.Remove(entry.path)
+}
+
+// delete evicts the content with the key, once it's removed from the cold
+// tier.
+func (cc *coldCache) delete(key string) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if elem, ok := cc.entries[key]; ok {
+		cc.remove(elem)
+	}
+}
@@ -0,0 +1,62 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColdCache(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "coldcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	cache, err := newColdCache(filepath.Join(rootDir, ColdCacheDirName), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches := make(map[string]int)
+	read := func(key string, size int) {
+		file, err := cache.open(key, func(path string) error {
+			fetches[key]++
+			return ioutil.WriteFile(path, make([]byte, size), 0600)
+		}, func(path string) (objectFile, error) {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			return &plainFile{file}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		// evicted contents stay readable once opened
+		if size, err := file.Size(); err != nil || size == 0 {
+			t.Errorf("%s: unexpected size %d: %v", key, size, err)
+		}
+	}
+
+	read("a", 4)
+	read("a", 4)
+	read("b", 4)
+	read("a", 4) // b is the least recently opened
+	read("c", 4) // evicts b
+	read("a", 4)
+	read("b", 4)  // evicts c
+	read("d", 20) // larger than the cache, evicts all
+	read("d", 20)
+
+	want := map[string]int{"a": 1, "b": 2, "c": 1, "d": 2}
+	for key, count := range want {
+		if fetches[key] != count {
+			t.Errorf("%s: fetched %d times, want %d", key, fetches[key], count)
+		}
+	}
+	if cache.size != 0 || cache.lru.Len() != 0 {
+		t.Errorf("unexpected cache size %d with %d contents", cache.size, cache.lru.Len())
+	}
+}
@@ -0,0 +1,47 @@
+package filestore
+
+import (
+	"sync/atomic"
+
+	"0chain.net/blobbercore/config"
+	"0chain.net/core/common"
+)
+
+// Number of reads of committed files served from the local disk and from
+// the cold tier since the start.
+var localTierReads, coldTierReads int64
+
+// GetTierReads returns the number of reads of committed files served from
+// the local disk and from the cold tier.
+func GetTierReads() (local int64, cold int64) {
+	return atomic.LoadInt64(&localTierReads), atomic.LoadInt64(&coldTierReads)
+}
+
+var errColdStorageDisabled = common.NewError("cold_storage_disabled", "Cold storage is not enabled")
+
+// ColdTier stores the content of cold files moved off the local disk. The
+// contents are stored by their hash, shared by all allocations.
+type ColdTier interface {
+	// Upload stores the file as the content with the given hash.
+	Upload(hash, filePath string) error
+	// Download writes the content with the given hash to the file path.
+	Download(hash, filePath string) error
+	// Remove deletes the content with the given hash, if stored.
+	Remove(hash string) error
+}
+
+// newColdTier returns the cold tier chosen in the configuration, or nil if
+// cold storage is disabled.
+func newColdTier() ColdTier {
+	switch config.Configuration.ColdStorageTier {
+	case "":
+		return nil
+	case config.ColdTierMinio:
+		return newMinioTier()
+	case config.ColdTierLocal:
+		return newLocalTier(config.Configuration.ColdStorageLocalPath)
+	default:
+		panic(common.NewErrorf("invalid_cold_tier", "Unknown cold storage tier: %v",
+			config.Configuration.ColdStorageTier))
+	}
+}
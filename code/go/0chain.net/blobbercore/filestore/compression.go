@@ -0,0 +1,258 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"0chain.net/blobbercore/config"
+	"0chain.net/core/common"
+)
+
+// Compressed objects. Every CHUNK_SIZE block of the content is compressed on
+// its own, or kept raw if it doesn't compress, so any block can be read
+// without decompressing the blocks before it. The blocks are followed by
+// their index and a trailer:
+//
+//	magic | blocks | index entry per block | logical size, index offset, number of blocks, magic
+//
+// An object starting with the magic is always a compressed object: content
+// starting with it, or with the magic of encrypted files, is stored
+// compressed even if compression is disabled.
+const (
+	compressedFileMagic   = "0CHNZIP1"
+	compressedIndexEntry  = 8 + 4 + 1
+	compressedTrailerSize = 8 + 8 + 4 + len(compressedFileMagic)
+
+	blockRaw        = 0
+	blockCompressed = 1
+)
+
+type compressedBlock struct {
+	offset int64
+	length int64
+	flags  byte
+}
+
+// compressObject compresses the temporary file of an upload in place if
+// compression is enabled and saves space, or if it must be stored as a
+// compressed object anyway.
+func (fs *FileFSStore) compressObject(allocation *StoreAllocation, tempFilePath string) error {
+	src, err := fs.openObjectFile(allocation, tempFilePath, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	size, err := src.Size()
+	if err != nil {
+		return err
+	}
+
+	magic := make([]byte, len(compressedFileMagic))
+	n, _ := src.ReadAt(magic, 0)
+	force := n == len(magic) &&
+		(bytes.Equal(magic, []byte(compressedFileMagic)) || bytes.Equal(magic, []byte(encryptedFileMagic)))
+	if !config.Configuration.CompressionEnabled && !force {
+		return nil
+	}
+
+	dstPath := tempFilePath + ".compressed"
+	dst, err := fs.createObjectFile(allocation, dstPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dstPath)
+	defer dst.Close()
+
+	w := &objectFileWriter{file: dst}
+	if _, err = w.Write([]byte(compressedFileMagic)); err != nil {
+		return err
+	}
+
+	var (
+		blocks []compressedBlock
+		buf    = make([]byte, CHUNK_SIZE)
+		cbuf   bytes.Buffer
+	)
+	fw, err := flate.NewWriter(&cbuf, config.Configuration.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	for offset := int64(0); offset < size; offset += CHUNK_SIZE {
+		n, err := src.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		data, flags := buf[:n], byte(blockRaw)
+		if config.Configuration.CompressionEnabled {
+			cbuf.Reset()
+			fw.Reset(&cbuf)
+			if _, err = fw.Write(data); err == nil {
+				err = fw.Close()
+			}
+			if err != nil {
+				return err
+			}
+			if cbuf.Len() < n {
+				data, flags = cbuf.Bytes(), blockCompressed
+			}
+		}
+		blocks = append(blocks, compressedBlock{offset: w.offset, length: int64(len(data)), flags: flags})
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	indexOffset := w.offset
+	entry := make([]byte, compressedIndexEntry)
+	for _, block := range blocks {
+		binary.BigEndian.PutUint64(entry[0:8], uint64(block.offset))
+		binary.BigEndian.PutUint32(entry[8:12], uint32(block.length))
+		entry[12] = block.flags
+		if _, err = w.Write(entry); err != nil {
+			return err
+		}
+	}
+	trailer := make([]byte, compressedTrailerSize)
+	binary.BigEndian.PutUint64(trailer[0:8], uint64(size))
+	binary.BigEndian.PutUint64(trailer[8:16], uint64(indexOffset))
+	binary.BigEndian.PutUint32(trailer[16:20], uint32(len(blocks)))
+	copy(trailer[20:], compressedFileMagic)
+	if _, err = w.Write(trailer); err != nil {
+		return err
+	}
+
+	if !force && w.offset >= size {
+		return nil // doesn't save any space
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Rename(dstPath, tempFilePath)
+}
+
+// compressedFile reads the content of a compressed object.
+type compressedFile struct {
+	file   objectFile
+	size   int64
+	blocks []compressedBlock
+
+	mu         sync.Mutex
+	cacheBlock int64
+	cache      []byte
+}
+
+// openCompressedFile returns the file as is unless it's a compressed object.
+func openCompressedFile(file objectFile) (objectFile, error) {
+	physicalSize, err := file.Size()
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(compressedFileMagic))
+	if n, _ := file.ReadAt(magic, 0); n < len(magic) || !bytes.Equal(magic, []byte(compressedFileMagic)) {
+		return file, nil
+	}
+
+	errCorrupt := common.NewError("compressed_object_corrupt", "Index of the compressed object is corrupt")
+	if physicalSize < int64(len(compressedFileMagic)+compressedTrailerSize) {
+		return nil, errCorrupt
+	}
+	trailer := make([]byte, compressedTrailerSize)
+	if _, err = file.ReadAt(trailer, physicalSize-int64(compressedTrailerSize)); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint64(trailer[0:8]))
+	indexOffset := int64(binary.BigEndian.Uint64(trailer[8:16]))
+	numBlocks := int64(binary.BigEndian.Uint32(trailer[16:20]))
+	if string(trailer[20:]) != compressedFileMagic ||
+		indexOffset+numBlocks*compressedIndexEntry+int64(compressedTrailerSize) != physicalSize ||
+		numBlocks != (size+CHUNK_SIZE-1)/CHUNK_SIZE {
+		return nil, errCorrupt
+	}
+
+	index := make([]byte, numBlocks*compressedIndexEntry)
+	if _, err = file.ReadAt(index, indexOffset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	blocks := make([]compressedBlock, numBlocks)
+	for i := range blocks {
+		entry := index[int64(i)*compressedIndexEntry:]
+		blocks[i] = compressedBlock{
+			offset: int64(binary.BigEndian.Uint64(entry[0:8])),
+			length: int64(binary.BigEndian.Uint32(entry[8:12])),
+			flags:  entry[12],
+		}
+		if blocks[i].offset+blocks[i].length > indexOffset {
+			return nil, errCorrupt
+		}
+	}
+	return &compressedFile{file: file, size: size, blocks: blocks, cacheBlock: -1}, nil
+}
+
+// readBlock returns the uncompressed content of the block, keeping the last
+// block read for the sequential reads within it.
+func (cf *compressedFile) readBlock(blockNum int64) ([]byte, error) {
+	if blockNum == cf.cacheBlock {
+		return cf.cache, nil
+	}
+	block := cf.blocks[blockNum]
+	data := make([]byte, block.length)
+	if _, err := cf.file.ReadAt(data, block.offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if block.flags == blockCompressed {
+		var err error
+		if data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(data))); err != nil {
+			return nil, common.NewError("compressed_object_corrupt", err.Error())
+		}
+	}
+	expected := cf.size - blockNum*CHUNK_SIZE
+	if expected > CHUNK_SIZE {
+		expected = CHUNK_SIZE
+	}
+	if int64(len(data)) != expected {
+		return nil, common.NewError("compressed_object_corrupt", "Block of the compressed object is truncated")
+	}
+	cf.cacheBlock, cf.cache = blockNum, data
+	return data, nil
+}
+
+func (cf *compressedFile) ReadAt(p []byte, off int64) (int, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off < cf.size {
+		block, err := cf.readBlock(off / CHUNK_SIZE)
+		if err != nil {
+			return n, err
+		}
+		k := copy(p[n:], block[off%CHUNK_SIZE:])
+		n += k
+		off += int64(k)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (cf *compressedFile) Size() (int64, error) {
+	return cf.size, nil
+}
+
+func (cf *compressedFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, common.NewError("read_only_object", "Compressed objects can't be written")
+}
+
+func (cf *compressedFile) Truncate(size int64) error {
+	return common.NewError("read_only_object", "Compressed objects can't be written")
+}
+
+func (cf *compressedFile) Close() error {
+	return cf.file.Close()
+}
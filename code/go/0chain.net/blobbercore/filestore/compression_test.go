@@ -0,0 +1,147 @@
+package filestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"0chain.net/blobbercore/config"
+	"0chain.net/core/encryption"
+)
+
+func TestCompressObject(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "compression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	config.Configuration.CompressionEnabled = true
+	config.Configuration.CompressionLevel = -1
+	defer func() { config.Configuration.CompressionEnabled = false }()
+
+	fs := &FileFSStore{RootDirectory: rootDir}
+	allocation, err := fs.SetupAllocation(encryption.Hash("alloc"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// compressible blocks, then a block that doesn't compress
+	data := bytes.Repeat([]byte("0123456789abcdef"), 2*CHUNK_SIZE/16)
+	random := make([]byte, CHUNK_SIZE+100)
+	for i := range random {
+		random[i] = byte(i*7919 + i/13)
+	}
+	data = append(data, random...)
+	path := filepath.Join(allocation.TempObjectsPath, "object")
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.compressObject(allocation, path); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := fs.openObjectFile(allocation, path, os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	size, err := file.Size()
+	if err != nil || size != int64(len(data)) {
+		t.Fatalf("got size %d (%v), want %d", size, err, len(data))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= int64(len(data)) {
+		t.Errorf("object not compressed, %d bytes stored for %d", info.Size(), len(data))
+	}
+	for _, off := range []int64{3 * CHUNK_SIZE, 0, CHUNK_SIZE - 50, 2*CHUNK_SIZE + 7} {
+		buf := make([]byte, 100)
+		if _, err = file.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data[off:off+100]) {
+			t.Errorf("wrong content read at offset %d", off)
+		}
+	}
+	reader, err := newObjectFileReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil || !bytes.Equal(content, data) {
+		t.Errorf("wrong content read (%v)", err)
+	}
+}
+
+func TestCompressObjectLookingCompressed(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "compression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	fs := &FileFSStore{RootDirectory: rootDir}
+	allocation, err := fs.SetupAllocation(encryption.Hash("alloc"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// content with the magic of compressed or encrypted objects is read as
+	// it was uploaded, even with compression disabled
+	for _, magic := range []string{compressedFileMagic, encryptedFileMagic} {
+		data := []byte(magic + " uploaded content")
+		path := filepath.Join(allocation.TempObjectsPath, "object")
+		if err = ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = fs.compressObject(allocation, path); err != nil {
+			t.Fatal(err)
+		}
+		file, err := fs.openObjectFile(allocation, path, os.O_RDONLY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := newObjectFileReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		file.Close()
+		if err != nil || !bytes.Equal(content, data) {
+			t.Errorf("got content %q (%v), want %q", content, err, data)
+		}
+	}
+}
+
+func TestObjectAllocation(t *testing.T) {
+	fs := &FileFSStore{RootDirectory: "/blobber/files"}
+	allocationID := encryption.Hash("alloc")
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirPath, destFile := GetFilePathFromHash(encryption.Hash("content"))
+
+	tests := []struct {
+		path   string
+		object bool
+	}{
+		{filepath.Join(allocation.ObjectsPath, dirPath, destFile), true},
+		{filepath.Join(allocation.TempObjectsPath, "upload"), false},
+		{filepath.Join(allocation.Path, MerkleTreesDirName, dirPath, destFile), false},
+		{filepath.Join(fs.contentStorePath(), dirPath, destFile), false},
+		{filepath.Join(fs.RootDirectory, ColdCacheDirName, "cold-1"), false},
+		{filepath.Join(fs.RootDirectory, "a", "b", "c", "d", ObjectsDirName, "e"), false},
+	}
+	for _, tt := range tests {
+		got, ok := fs.objectAllocation(tt.path)
+		if ok != tt.object || (ok && got.ID != allocationID) {
+			t.Errorf("%s: got object %v, want %v", tt.path, ok, tt.object)
+		}
+	}
+}
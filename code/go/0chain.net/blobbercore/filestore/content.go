@@ -0,0 +1,147 @@
+package filestore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+)
+
+// ContentDirName is the directory of the content addressed store. Every
+// distinct content is stored there once, and the objects of allocations
+// are hard links to it. The number of links is the reference count of the
+// content, it's removed when no allocation links to it anymore.
+const ContentDirName = "content"
+
+// contentStorePath returns the directory of the content addressed store.
+func (fs *FileFSStore) contentStorePath() string {
+	return filepath.Join(fs.RootDirectory, ContentDirName)
+}
+
+// contentPath returns the path of the content of the allocation with the
+// given hash.
+func (fs *FileFSStore) contentPath(allocationID string, hash string) string {
+	dirPath, destFile := GetFilePathFromHash(fs.contentKey(allocationID, hash))
+	return filepath.Join(fs.contentStorePath(), dirPath, destFile)
+}
+
+// linkContent stores the file at the temp path as the content with the
+// given hash, unless the same content is already stored, and links it to
+// the object path of an allocation.
+func (fs *FileFSStore) linkContent(allocationID, tempFilePath, fileObjectPath, hash string) error {
+	contentPath := fs.contentPath(allocationID, hash)
+
+	mutex := lock.GetMutex(ContentDirName, contentPath)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, err := os.Stat(contentPath); os.IsNotExist(err) {
+		if err = createDirs(filepath.Dir(contentPath)); err != nil {
+			return common.NewError("blob_object_dir_creation_error", err.Error())
+		}
+		if err = os.Rename(tempFilePath, contentPath); err != nil {
+			return common.NewError("blob_object_creation_error", err.Error())
+		}
+	} else if err != nil {
+		return common.NewError("blob_object_creation_error", err.Error())
+	} else {
+		os.Remove(tempFilePath) // same content is already stored
+	}
+
+	contentInfo, err := os.Stat(contentPath)
+	if err != nil {
+		return common.NewError("blob_object_creation_error", err.Error())
+	}
+	if objectInfo, err := os.Stat(fileObjectPath); err == nil && os.SameFile(contentInfo, objectInfo) {
+		return nil
+	}
+
+	// replace the object atomically, it may be a copy stored before the
+	// content store or a copy downloaded from the cloud
+	linkPath := fileObjectPath + ".link"
+	os.Remove(linkPath)
+	if err = os.Link(contentPath, linkPath); err != nil {
+		return common.NewError("blob_object_creation_error", err.Error())
+	}
+	if err = os.Rename(linkPath, fileObjectPath); err != nil {
+		os.Remove(linkPath)
+		return common.NewError("blob_object_creation_error", err.Error())
+	}
+	return nil
+}
+
+// restoreContent overwrites the stored content with the given hash by the
+// file at the temp path. The content is rewritten in place, so the objects
+// of every allocation linking to it get the restored copy.
+func (fs *FileFSStore) restoreContent(allocationID, tempFilePath, hash string) error {
+	contentPath := fs.contentPath(allocationID, hash)
+
+	mutex := lock.GetMutex(ContentDirName, contentPath)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, err := os.Stat(contentPath); os.IsNotExist(err) {
+		return nil // linked from the temp file
+	} else if err != nil {
+		return common.NewError("blob_object_restore_error", err.Error())
+	}
+	src, err := os.Open(tempFilePath)
+	if err != nil {
+		return common.NewError("blob_object_restore_error", err.Error())
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(contentPath, os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return common.NewError("blob_object_restore_error", err.Error())
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return common.NewError("blob_object_restore_error", err.Error())
+	}
+	if err = dst.Close(); err != nil {
+		return common.NewError("blob_object_restore_error", err.Error())
+	}
+	return nil
+}
+
+// ReleaseObject removes the object of the allocation stored under the
+// content hash, and the content itself if no other allocation links to it.
+func (fs *FileFSStore) ReleaseObject(allocationID string, hash string) error {
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+
+	dirPath, destFile := GetFilePathFromHash(hash)
+	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath, destFile)
+	contentPath := fs.contentPath(allocationID, hash)
+
+	mutex := lock.GetMutex(ContentDirName, contentPath)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	err = os.Remove(fileObjectPath)
+	if info, serr := os.Stat(contentPath); serr == nil && numLinks(info) <= 1 {
+		os.Remove(contentPath)
+	}
+	return err
+}
+
+// numLinks returns the number of hard links to the file.
+func numLinks(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Nlink)
+	}
+	return 1
+}
+
+// inode returns the inode number of the file, or false if unknown.
+func inode(info os.FileInfo) (uint64, bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino), true
+	}
+	return 0, false
+}
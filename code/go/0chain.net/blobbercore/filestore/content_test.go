@@ -0,0 +1,157 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"0chain.net/core/encryption"
+)
+
+func TestContentDeduplication(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	fs := &FileFSStore{RootDirectory: rootDir}
+	data := []byte("same content")
+	hash := encryption.Hash(data)
+
+	var objectPaths []string
+	for _, allocationID := range []string{encryption.Hash("alloc1"), encryption.Hash("alloc2")} {
+		allocation, err := fs.SetupAllocation(allocationID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tempFilePath := filepath.Join(allocation.TempObjectsPath, "upload")
+		if err = ioutil.WriteFile(tempFilePath, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		dirPath, destFile := GetFilePathFromHash(hash)
+		objectPath := filepath.Join(allocation.ObjectsPath, dirPath, destFile)
+		if err = createDirs(filepath.Dir(objectPath)); err != nil {
+			t.Fatal(err)
+		}
+		if err = fs.linkContent(allocationID, tempFilePath, objectPath, hash); err != nil {
+			t.Fatal(err)
+		}
+		objectPaths = append(objectPaths, objectPath)
+	}
+
+	size, err := fs.GetTotalDiskSizeUsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("got disk size used %d, want %d", size, len(data))
+	}
+
+	if err = fs.ReleaseObject(encryption.Hash("alloc1"), hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(objectPaths[1]); err != nil {
+		t.Errorf("object of the other allocation removed: %v", err)
+	}
+	if _, err = os.Stat(fs.contentPath("", hash)); err != nil {
+		t.Errorf("content still referenced removed: %v", err)
+	}
+
+	if err = fs.ReleaseObject(encryption.Hash("alloc2"), hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(fs.contentPath("", hash)); !os.IsNotExist(err) {
+		t.Errorf("content not referenced anymore not removed: %v", err)
+	}
+}
+
+func TestRestoreFromCloud(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	coldDir, err := ioutil.TempDir("", "coldtier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(coldDir)
+
+	fs := &FileFSStore{RootDirectory: rootDir, ColdTier: newLocalTier(coldDir)}
+	data := []byte("content restored from the cloud")
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+
+	var objectPaths []string
+	for _, allocationID := range []string{encryption.Hash("alloc1"), encryption.Hash("alloc2")} {
+		allocation, err := fs.SetupAllocation(allocationID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tempFilePath := filepath.Join(allocation.TempObjectsPath, "upload")
+		if err = ioutil.WriteFile(tempFilePath, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		dirPath, destFile := GetFilePathFromHash(hash)
+		objectPath := filepath.Join(allocation.ObjectsPath, dirPath, destFile)
+		if err = createDirs(filepath.Dir(objectPath)); err != nil {
+			t.Fatal(err)
+		}
+		if err = fs.linkContent(allocationID, tempFilePath, objectPath, hash); err != nil {
+			t.Fatal(err)
+		}
+		objectPaths = append(objectPaths, objectPath)
+	}
+	if err = fs.UploadToCloud(encryption.Hash("alloc1"), hash, objectPaths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the shared content and remove the object of the first allocation
+	if err = ioutil.WriteFile(fs.contentPath("", hash), []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(objectPaths[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fs.RestoreFromCloud(encryption.Hash("alloc1"), hash); err != nil {
+		t.Fatal(err)
+	}
+	for _, objectPath := range objectPaths {
+		got, err := ioutil.ReadFile(objectPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("got object %q, want %q", got, data)
+		}
+	}
+	size, err := fs.GetTotalDiskSizeUsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("got disk size used %d, want %d", size, len(data))
+	}
+
+	// a copy not matching the hash is not restored
+	badPath := filepath.Join(coldDir, "bad")
+	if err = ioutil.WriteFile(badPath, []byte("bad copy"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.UploadToCloud(encryption.Hash("alloc1"), hash, badPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.RestoreFromCloud(encryption.Hash("alloc1"), hash); err == nil {
+		t.Error("expected a copy not matching the hash to be rejected")
+	}
+	if got, _ := ioutil.ReadFile(objectPaths[1]); !bytes.Equal(got, data) {
+		t.Errorf("got object %q after a rejected restore, want %q", got, data)
+	}
+}
@@ -2,16 +2,20 @@ package filestore
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	. "0chain.net/core/logging"
 	"go.uber.org/zap"
@@ -22,7 +26,6 @@ import (
 	"0chain.net/blobbercore/config"
 
 	"0chain.net/core/util"
-	"github.com/minio/minio-go"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -33,19 +36,14 @@ const (
 	CurrentVersion            = "1.0"
 )
 
-type MinioConfiguration struct {
-	StorageServiceURL string
-	AccessKeyID       string
-	SecretAccessKey   string
-	BucketName        string
-	BucketLocation    string
-}
-
-var MinioConfig MinioConfiguration
-
 type FileFSStore struct {
 	RootDirectory string
-	Minio         *minio.Client
+	ColdTier      ColdTier
+
+	coldCache *coldCache
+
+	masterKey cipher.AEAD
+	dataKeys  sync.Map // allocation id -> cipher.Block
 }
 
 type StoreAllocation struct {
@@ -57,46 +55,28 @@ type StoreAllocation struct {
 
 func SetupFSStore(rootDir string) FileStore {
 	createDirs(rootDir)
-	fsStore = &FileFSStore{
+	fs := &FileFSStore{
 		RootDirectory: rootDir,
-		Minio:         intializeMinio(),
-	}
-	return fsStore
-}
-
-func intializeMinio() *minio.Client {
-	if !config.Configuration.MinioStart {
-		return nil
+		ColdTier:      newColdTier(),
 	}
-	minioClient, err := minio.New(
-		MinioConfig.StorageServiceURL,
-		MinioConfig.AccessKeyID,
-		MinioConfig.SecretAccessKey,
-		config.Configuration.MinioUseSSL,
-	)
-	if err != nil {
-		Logger.Panic("Unable to initiaze minio cliet", zap.Error(err))
-		panic(err)
+	if keyFile := config.Configuration.EncryptionAtRestKeyFile; len(keyFile) != 0 {
+		masterKey, err := loadMasterKey(keyFile)
+		if err != nil {
+			Logger.Panic("Unable to load the encryption at rest master key", zap.Error(err))
+			panic(err)
+		}
+		fs.masterKey = masterKey
 	}
-
-	checkBucket(minioClient, MinioConfig.BucketName)
-	return minioClient
-}
-
-func checkBucket(minioClient *minio.Client, bucketName string) {
-	err := minioClient.MakeBucket(bucketName, MinioConfig.BucketLocation)
-	if err != nil {
-		Logger.Error("Error with make bucket, Will check if bucket exists", zap.Error(err))
-		exists, errBucketExists := minioClient.BucketExists(bucketName)
-		if errBucketExists == nil && exists {
-			Logger.Info("We already own ", zap.Any("bucket_name", bucketName))
-		} else {
-			Logger.Error("Minio bucket error", zap.Error(errBucketExists), zap.Any("bucket_name", bucketName))
-			panic(errBucketExists)
+	if fs.ColdTier != nil && config.Configuration.ColdStorageCacheSize > 0 {
+		cache, err := newColdCache(filepath.Join(rootDir, ColdCacheDirName), config.Configuration.ColdStorageCacheSize)
+		if err != nil {
+			Logger.Panic("Unable to set up the cold storage cache", zap.Error(err))
+			panic(err)
 		}
-	} else {
-		Logger.Info(bucketName + " bucket successfully created")
+		fs.coldCache = cache
 	}
+	fsStore = fs
+	return fsStore
 }
 
 func createDirs(dir string) error {
@@ -127,32 +107,99 @@ func (fs *FileFSStore) GetTempPathSize(allocationID string) (int64, error) {
 	return size, err
 }
 
+// GetTotalDiskSizeUsed returns the size of all files on disk, counting
+// contents shared by several allocations once.
 func (fs *FileFSStore) GetTotalDiskSizeUsed() (int64, error) {
-	var size int64
-	err := filepath.Walk(fs.RootDirectory, func(_ string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			size += info.Size()
-		}
-		return err
-	})
+	size, _, err := fs.diskUsage(fs.RootDirectory)
+	return size, err
+}
+
+// GetTotalLogicalDiskSizeUsed returns the size GetTotalDiskSizeUsed would
+// return if the objects weren't compressed.
+func (fs *FileFSStore) GetTotalLogicalDiskSizeUsed() (int64, error) {
+	_, size, err := fs.diskUsage(fs.RootDirectory)
 	return size, err
 }
 
 func (fs *FileFSStore) GetlDiskSizeUsed(allocationID string) (int64, error) {
-	var size int64
-	err := filepath.Walk(fs.generateTransactionPath(allocationID), func(_ string, info os.FileInfo, err error) error {
+	size, _, err := fs.diskUsage(fs.generateTransactionPath(allocationID))
+	return size, err
+}
+
+// GetLogicalDiskSizeUsed returns the size GetlDiskSizeUsed would return if
+// the objects of the allocation weren't compressed.
+func (fs *FileFSStore) GetLogicalDiskSizeUsed(allocationID string) (int64, error) {
+	_, size, err := fs.diskUsage(fs.generateTransactionPath(allocationID))
+	return size, err
+}
+
+// diskUsage returns the physical size of the files under the directory, and
+// their logical size with the objects counted uncompressed. Files linked
+// several times are counted once, the contents of the content store through
+// the objects linking to them.
+func (fs *FileFSStore) diskUsage(dir string) (physical int64, logical int64, err error) {
+	inodes := make(map[uint64]bool)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			size += info.Size()
+		if info.IsDir() {
+			return nil
 		}
-		return err
+		if ino, ok := inode(info); ok && numLinks(info) > 1 {
+			if isWithinDir(fs.contentStorePath(), path) || inodes[ino] {
+				return nil
+			}
+			inodes[ino] = true
+		}
+		physical += info.Size()
+		logical += info.Size()
+		if allocation, ok := fs.objectAllocation(path); ok {
+			if size, err := fs.objectSize(allocation, path); err == nil {
+				logical += size - info.Size()
+			}
+		}
+		return nil
 	})
-	return size, err
+	return physical, logical, err
+}
+
+// isWithinDir tells if the path is in the directory or its subdirectories.
+func isWithinDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// objectAllocation returns the allocation of the committed object at the
+// path, false if the path isn't one of a committed object.
+func (fs *FileFSStore) objectAllocation(path string) (*StoreAllocation, bool) {
+	rel, err := filepath.Rel(fs.RootDirectory, path)
+	if err != nil {
+		return nil, false
+	}
+	// allocations are at their id split in 4, as by generateTransactionPath
+	parts := strings.SplitN(rel, string(os.PathSeparator), 5)
+	allocationID := strings.Join(parts[:len(parts)-1], "")
+	if len(parts) < 5 || len(allocationID) < 9 {
+		return nil, false
+	}
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil || !isWithinDir(allocation.ObjectsPath, path) ||
+		isWithinDir(allocation.TempObjectsPath, path) {
+		return nil, false
+	}
+	return allocation, true
+}
+
+// objectSize returns the size of the content of an object.
+func (fs *FileFSStore) objectSize(allocation *StoreAllocation, path string) (int64, error) {
+	file, err := fs.openObjectFile(allocation, path, os.O_RDONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return file.Size()
 }
 
 func GetFilePathFromHash(hash string) (string, string) {
@@ -202,53 +249,169 @@ func (fs *FileFSStore) SetupAllocation(allocationID string, skipCreate bool) (*S
 	return allocation, nil
 }
 
-func (fs *FileFSStore) GetFileBlockForChallenge(allocationID string, fileData *FileInputData, blockoffset int) (json.RawMessage, util.MerkleTreeI, error) {
-	allocation, err := fs.SetupAllocation(allocationID, true)
-	if err != nil {
-		return nil, nil, common.NewError("invalid_allocation", "Invalid allocation. "+err.Error())
-	}
+// openObject opens the committed object of the file. A file moved to the
+// cold tier is fetched to the cold cache if there's one, or else to a
+// temporary file unlinked once opened, so reads of cold files don't bring
+// them back to the local disk.
+func (fs *FileFSStore) openObject(allocation *StoreAllocation, fileData *FileInputData) (objectFile, error) {
 	dirPath, destFile := GetFilePathFromHash(fileData.Hash)
 	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
 	fileObjectPath = filepath.Join(fileObjectPath, destFile)
 
-	file, err := os.Open(fileObjectPath)
+	file, err := fs.openObjectFile(allocation, fileObjectPath, os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) && fileData.OnCloud {
-			err = fs.DownloadFromCloud(fileData.Hash, fileObjectPath)
-			if err != nil {
-				return nil, nil, common.NewError("minio_download_failed", "Unable to download from minio with err "+err.Error())
+			atomic.AddInt64(&coldTierReads, 1)
+			if fs.coldCache != nil {
+				file, err := fs.coldCache.open(fs.contentKey(allocation.ID, fileData.Hash),
+					func(path string) error {
+						return fs.DownloadFromCloud(allocation.ID, fileData.Hash, path)
+					},
+					func(path string) (objectFile, error) {
+						return fs.openObjectFile(allocation, path, os.O_RDONLY)
+					})
+				if err != nil {
+					return nil, common.NewError("cold_storage_download_failed", "Unable to download from cold storage with err "+err.Error())
+				}
+				return file, nil
 			}
-			file, err = os.Open(fileObjectPath)
+			tempFilePath, err := fs.fetchFromCloud(allocation, fileData.Hash)
 			if err != nil {
-				return nil, nil, err
+				return nil, common.NewError("cold_storage_download_failed", "Unable to download from cold storage with err "+err.Error())
 			}
-		} else {
-			return nil, nil, err
+			defer os.Remove(tempFilePath)
+			return fs.openObjectFile(allocation, tempFilePath, os.O_RDONLY)
 		}
+		return nil, err
+	}
+	atomic.AddInt64(&localTierReads, 1)
+	return file, nil
+}
+
+// fetchFromCloud downloads the content from the cold tier to a new file in
+// the temp path of the allocation.
+func (fs *FileFSStore) fetchFromCloud(allocation *StoreAllocation, hash string) (string, error) {
+	if err := createDirs(allocation.TempObjectsPath); err != nil {
+		return "", err
+	}
+	tempFile, err := ioutil.TempFile(allocation.TempObjectsPath, "cold-")
+	if err != nil {
+		return "", err
+	}
+	tempFile.Close()
+	if err = fs.DownloadFromCloud(allocation.ID, hash, tempFile.Name()); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
+
+// PromoteFromCloud brings the content of a file moved to the cold tier back
+// to the local disk of the allocation.
+func (fs *FileFSStore) PromoteFromCloud(allocationID string, hash string) error {
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+	tempFilePath, err := fs.fetchFromCloud(allocation, hash)
+	if err != nil {
+		return common.NewError("cold_storage_download_failed", "Unable to download from cold storage with err "+err.Error())
+	}
+	dirPath, destFile := GetFilePathFromHash(hash)
+	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
+	if err = createDirs(fileObjectPath); err != nil {
+		os.Remove(tempFilePath)
+		return common.NewError("blob_object_dir_creation_error", err.Error())
+	}
+	if err = fs.linkContent(allocationID, tempFilePath, filepath.Join(fileObjectPath, destFile), hash); err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+	return nil
+}
+
+// RestoreFromCloud replaces the missing or corrupt local content of an
+// object by its copy in the cold tier. The copy is the object as uploaded,
+// with its encryption and compression framing, and is checked against the
+// hash before it's stored.
+func (fs *FileFSStore) RestoreFromCloud(allocationID string, hash string) error {
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+	tempFilePath, err := fs.fetchFromCloud(allocation, hash)
+	if err != nil {
+		return common.NewError("cold_storage_download_failed", "Unable to download from cold storage with err "+err.Error())
+	}
+	defer os.Remove(tempFilePath)
+
+	object, err := fs.getObjectInfo(allocation, tempFilePath)
+	if err != nil {
+		return common.NewError("cold_storage_download_failed", "Unable to read the copy from cold storage with err "+err.Error())
+	}
+	if object.ContentHash != hash {
+		return common.NewError("cold_storage_corrupt", "Copy in cold storage doesn't match its hash")
+	}
+
+	if err = fs.restoreContent(allocationID, tempFilePath, hash); err != nil {
+		return err
+	}
+	dirPath, destFile := GetFilePathFromHash(hash)
+	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
+	if err = createDirs(fileObjectPath); err != nil {
+		return common.NewError("blob_object_dir_creation_error", err.Error())
+	}
+	return fs.linkContent(allocationID, tempFilePath, filepath.Join(fileObjectPath, destFile), hash)
+}
+
+func (fs *FileFSStore) GetFileBlockForChallenge(allocationID string, fileData *FileInputData, blockoffset int) (json.RawMessage, util.MerkleTreeI, error) {
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return nil, nil, common.NewError("invalid_allocation", "Invalid allocation. "+err.Error())
+	}
+
+	file, err := fs.openObject(allocation, fileData)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer file.Close()
 
-	if blockoffset < 0 || blockoffset >= 1024 {
+	if blockoffset < 0 || blockoffset >= merkleLeavesCount {
 		return nil, nil, common.NewError("invalid_block_number", "Invalid block offset")
 	}
 
+	fileReader, err := newObjectFileReader(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merkleTreePath := fs.merkleTreePath(allocation, fileData.Hash)
+	if mt, err := readMerkleTree(merkleTreePath); err == nil {
+		returnBytes, err := readChallengeBlock(file, fileReader.Size(), blockoffset)
+		if err != nil {
+			return nil, nil, common.NewError("file_read_error", err.Error())
+		}
+		return returnBytes, mt, nil
+	} else if !os.IsNotExist(err) {
+		Logger.Error("Rebuilding corrupted merkle tree of the file", zap.String("path", fileData.Path), zap.Error(err))
+	}
+
 	var returnBytes []byte
 
-	merkleHashes := make([]hash.Hash, 1024)
-	merkleLeaves := make([]util.Hashable, 1024)
+	merkleHashes := make([]hash.Hash, merkleLeavesCount)
+	merkleLeaves := make([]util.Hashable, merkleLeavesCount)
 	for idx := range merkleHashes {
 		merkleHashes[idx] = sha3.New256()
 	}
 	bytesBuf := bytes.NewBuffer(make([]byte, 0))
 	for true {
-		_, err := io.CopyN(bytesBuf, file, CHUNK_SIZE)
+		_, err := io.CopyN(bytesBuf, fileReader, CHUNK_SIZE)
 		if err != io.EOF && err != nil {
 			return nil, nil, common.NewError("file_write_error", err.Error())
 		}
 		dataBytes := bytesBuf.Bytes()
 		tmpBytes := make([]byte, len(dataBytes))
 		copy(tmpBytes, dataBytes)
-		merkleChunkSize := 64
 		for i := 0; i < len(tmpBytes); i += merkleChunkSize {
 			end := i + merkleChunkSize
 			if end > len(tmpBytes) {
@@ -272,48 +435,46 @@ func (fs *FileFSStore) GetFileBlockForChallenge(allocationID string, fileData *F
 	var mt util.MerkleTreeI = &util.MerkleTree{}
 	mt.ComputeTree(merkleLeaves)
 
+	if err = writeMerkleTree(merkleTreePath, mt); err != nil {
+		Logger.Error("Unable to write merkle tree of the file", zap.String("path", fileData.Path), zap.Error(err))
+	}
+
 	return returnBytes, mt, nil
 }
 
+// checkBlockNum validates the block number against the size of the file.
+func checkBlockNum(file objectFile, blockNum int64) (filesize int64, err error) {
+	filesize, err = file.Size()
+	if err != nil {
+		return 0, err
+	}
+
+	maxBlockNum := filesize / CHUNK_SIZE
+	// check for any left over bytes. Add one more go routine if required.
+	if remainder := filesize % CHUNK_SIZE; remainder != 0 {
+		maxBlockNum++
+	}
+
+	if blockNum > maxBlockNum || blockNum < 1 {
+		return 0, common.NewError("invalid_block_number", "Invalid block number")
+	}
+	return filesize, nil
+}
+
 func (fs *FileFSStore) GetFileBlock(allocationID string, fileData *FileInputData, blockNum int64, numBlocks int64) ([]byte, error) {
 	allocation, err := fs.SetupAllocation(allocationID, true)
 	if err != nil {
 		return nil, common.NewError("invalid_allocation", "Invalid allocation. "+err.Error())
 	}
-	dirPath, destFile := GetFilePathFromHash(fileData.Hash)
-	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
-	fileObjectPath = filepath.Join(fileObjectPath, destFile)
 
-	file, err := os.Open(fileObjectPath)
-	if err != nil {
-		if os.IsNotExist(err) && fileData.OnCloud {
-			err = fs.DownloadFromCloud(fileData.Hash, fileObjectPath)
-			if err != nil {
-				return nil, common.NewError("minio_download_failed", "Unable to download from minio with err "+err.Error())
-			}
-			file, err = os.Open(fileObjectPath)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
-	}
-	defer file.Close()
-	fileinfo, err := file.Stat()
+	file, err := fs.openObject(allocation, fileData)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	filesize := int(fileinfo.Size())
-	maxBlockNum := int64(filesize / CHUNK_SIZE)
-	// check for any left over bytes. Add one more go routine if required.
-	if remainder := filesize % CHUNK_SIZE; remainder != 0 {
-		maxBlockNum++
-	}
-
-	if blockNum > maxBlockNum || blockNum < 1 {
-		return nil, common.NewError("invalid_block_number", "Invalid block number")
+	if _, err = checkBlockNum(file, blockNum); err != nil {
+		return nil, err
 	}
 	buffer := make([]byte, CHUNK_SIZE*numBlocks)
 	n, err := file.ReadAt(buffer, ((blockNum - 1) * CHUNK_SIZE))
@@ -324,6 +485,50 @@ func (fs *FileFSStore) GetFileBlock(allocationID string, fileData *FileInputData
 	return buffer[:n], nil
 }
 
+// objectReader reads a section of an opened object file and closes
+// the file along with it.
+type objectReader struct {
+	*io.SectionReader
+	file objectFile
+}
+
+func (or *objectReader) Close() error {
+	return or.file.Close()
+}
+
+// GetFileBlockReader is the streaming counterpart of GetFileBlock. It
+// returns a reader of the requested blocks and the number of bytes it
+// yields, without buffering the blocks in memory. The caller must close
+// the reader.
+func (fs *FileFSStore) GetFileBlockReader(allocationID string, fileData *FileInputData, blockNum int64, numBlocks int64) (io.ReadCloser, int64, error) {
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return nil, 0, common.NewError("invalid_allocation", "Invalid allocation. "+err.Error())
+	}
+
+	file, err := fs.openObject(allocation, fileData)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filesize, err := checkBlockNum(file, blockNum)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	offset := (blockNum - 1) * CHUNK_SIZE
+	length := CHUNK_SIZE * numBlocks
+	if offset+length > filesize {
+		length = filesize - offset
+	}
+
+	return &objectReader{
+		SectionReader: io.NewSectionReader(file, offset, length),
+		file:          file,
+	}, length, nil
+}
+
 func (fs *FileFSStore) DeleteTempFile(allocationID string, fileData *FileInputData, connectionID string) error {
 	allocation, err := fs.SetupAllocation(allocationID, true)
 	if err != nil {
@@ -331,6 +536,7 @@ func (fs *FileFSStore) DeleteTempFile(allocationID string, fileData *FileInputDa
 	}
 
 	fileObjectPath := fs.generateTempPath(allocation, fileData, connectionID)
+	os.Remove(fileObjectPath + MerkleTreeSuffix)
 
 	return os.Remove(fileObjectPath)
 }
@@ -373,11 +579,30 @@ func (fs *FileFSStore) CommitWrite(allocationID string, fileData *FileInputData,
 		return false, common.NewError("blob_object_dir_creation_error", err.Error())
 	}
 	fileObjectPath = filepath.Join(fileObjectPath, destFile)
+	// the temp file is gone once moved to the content store, only the link
+	// is left to do when a commit interrupted by a crash is finished again
+	if _, err = os.Stat(tempFilePath); os.IsNotExist(err) {
+		if _, err = os.Stat(fs.contentPath(allocationID, fileData.Hash)); err == nil {
+			return true, fs.linkContent(allocationID, tempFilePath, fileObjectPath, fileData.Hash)
+		}
+	}
 	//if _, err := os.Stat(fileObjectPath); os.IsNotExist(err) {
-	err = os.Rename(tempFilePath, fileObjectPath)
+	if err = fs.compressObject(allocation, tempFilePath); err != nil {
+		return false, common.NewError("blob_object_compression_error", err.Error())
+	}
+	err = fs.linkContent(allocationID, tempFilePath, fileObjectPath, fileData.Hash)
 
 	if err != nil {
-		return false, common.NewError("blob_object_creation_error", err.Error())
+		return false, err
+	}
+
+	// a missing merkle tree is rebuilt on the first challenge
+	merkleTreePath := fs.merkleTreePath(allocation, fileData.Hash)
+	if err = createDirs(filepath.Dir(merkleTreePath)); err == nil {
+		err = os.Rename(tempFilePath+MerkleTreeSuffix, merkleTreePath)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		Logger.Error("Unable to store merkle tree of the file", zap.String("path", fileData.Path), zap.Error(err))
 	}
 	return true, nil
 	//}
@@ -385,24 +610,18 @@ func (fs *FileFSStore) CommitWrite(allocationID string, fileData *FileInputData,
 	//return false, err
 }
 
+// DeleteFile releases the object of the allocation stored under the content
+// hash, with its merkle tree. The cloud copy, shared by all allocations, is
+// left for the caller to remove.
 func (fs *FileFSStore) DeleteFile(allocationID string, contentHash string) error {
 	allocation, err := fs.SetupAllocation(allocationID, true)
 	if err != nil {
 		return common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
 	}
 
-	dirPath, destFile := GetFilePathFromHash(contentHash)
-	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
-	fileObjectPath = filepath.Join(fileObjectPath, destFile)
-
-	if config.Configuration.ColdStorageDeleteCloudCopy {
-		err = fs.RemoveFromCloud(contentHash)
-		if err != nil {
-			Logger.Error("Unable to delete object from minio", zap.Error(err))
-		}
-	}
+	os.Remove(fs.merkleTreePath(allocation, contentHash))
 
-	return os.Remove(fileObjectPath)
+	return fs.ReleaseObject(allocationID, contentHash)
 }
 
 func (fs *FileFSStore) GetMerkleTreeForFile(allocationID string, fileData *FileInputData) (util.MerkleTreeI, error) {
@@ -410,28 +629,21 @@ func (fs *FileFSStore) GetMerkleTreeForFile(allocationID string, fileData *FileI
 	if err != nil {
 		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
 	}
-	dirPath, destFile := GetFilePathFromHash(fileData.Hash)
-	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
-	fileObjectPath = filepath.Join(fileObjectPath, destFile)
 
-	file, err := os.Open(fileObjectPath)
+	if mt, err := readMerkleTree(fs.merkleTreePath(allocation, fileData.Hash)); err == nil {
+		return mt, nil
+	}
+
+	file, err := fs.openObject(allocation, fileData)
 	if err != nil {
-		if os.IsNotExist(err) && fileData.OnCloud {
-			err = fs.DownloadFromCloud(fileData.Hash, fileObjectPath)
-			if err != nil {
-				return nil, common.NewError("minio_download_failed", "Unable to download from minio with err "+err.Error())
-			}
-			file, err = os.Open(fileObjectPath)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
 	defer file.Close()
 	//merkleHash := sha3.New256()
-	tReader := file //io.TeeReader(file, merkleHash)
+	tReader, err := newObjectFileReader(file) //io.TeeReader(file, merkleHash)
+	if err != nil {
+		return nil, err
+	}
 	//merkleLeaves := make([]util.Hashable, 0)
 	merkleHashes := make([]hash.Hash, 1024)
 	merkleLeaves := make([]util.Hashable, 1024)
@@ -479,21 +691,33 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
 	}
 
-	h := sha1.New()
 	tempFilePath := fs.generateTempPath(allocation, fileData, connectionID)
-	dest, err := os.Create(tempFilePath)
+	dest, err := fs.createObjectFile(allocation, tempFilePath)
 	if err != nil {
 		return nil, common.NewError("file_creation_error", err.Error())
 	}
 	defer dest.Close()
-	// infile, err := hdr.Open()
-	// if err != nil {
-	// 	return nil, common.NewError("file_reading_error", err.Error())
-	// }
+
+	fileRef, mt, err := computeFileData(io.TeeReader(infile, &objectFileWriter{file: dest}))
+	if err != nil {
+		return nil, err
+	}
+	if err = writeMerkleTree(tempFilePath+MerkleTreeSuffix, mt); err != nil {
+		Logger.Error("Unable to write merkle tree of the file", zap.String("path", fileData.Path), zap.Error(err))
+	}
+	fileRef.Name = fileData.Name
+	fileRef.Path = fileData.Path
+
+	return fileRef, nil
+}
+
+// computeFileData reads the content through, computing its content hash,
+// merkle tree and size.
+func computeFileData(reader io.Reader) (*FileOutputData, util.MerkleTreeI, error) {
+	h := sha1.New()
 	bytesBuffer := bytes.NewBuffer(nil)
-	//merkleHash := sha3.New256()
 	multiHashWriter := io.MultiWriter(h, bytesBuffer)
-	tReader := io.TeeReader(infile, multiHashWriter)
+	tReader := io.TeeReader(reader, multiHashWriter)
 	merkleHashes := make([]hash.Hash, 1024)
 	merkleLeaves := make([]util.Hashable, 1024)
 	for idx := range merkleHashes {
@@ -501,9 +725,9 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 	}
 	fileSize := int64(0)
 	for true {
-		written, err := io.CopyN(dest, tReader, CHUNK_SIZE)
+		written, err := io.CopyN(ioutil.Discard, tReader, CHUNK_SIZE)
 		if err != io.EOF && err != nil {
-			return nil, common.NewError("file_write_error", err.Error())
+			return nil, nil, common.NewError("file_write_error", err.Error())
 		}
 		fileSize += written
 		dataBytes := bytesBuffer.Bytes()
@@ -517,7 +741,6 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 			merkleHashes[offset].Write(dataBytes[i:end])
 		}
 
-		// merkleLeaves = append(merkleLeaves, util.NewStringHashable(hex.EncodeToString(merkleHash.Sum(nil))))
 		bytesBuffer.Reset()
 		if err != nil && err == io.EOF {
 			break
@@ -526,17 +749,81 @@ func (fs *FileFSStore) WriteFile(allocationID string, fileData *FileInputData,
 	for idx := range merkleHashes {
 		merkleLeaves[idx] = util.NewStringHashable(hex.EncodeToString(merkleHashes[idx].Sum(nil)))
 	}
-	//Logger.Info("File size", zap.Int64("file_size", fileSize))
 	var mt util.MerkleTreeI = &util.MerkleTree{}
 	mt.ComputeTree(merkleLeaves)
-	//Logger.Info("Calculated Merkle root", zap.String("merkle_root", mt.GetRoot()), zap.Int("merkle_leaf_count", len(merkleLeaves)))
 
 	fileRef := &FileOutputData{}
 	fileRef.ContentHash = hex.EncodeToString(h.Sum(nil))
 	fileRef.Size = fileSize
+	fileRef.MerkleRoot = mt.GetRoot()
+
+	return fileRef, mt, nil
+}
+
+// WriteFileChunk writes a chunk of a file uploaded in parts at the given
+// offset of its temporary file. It returns the number of bytes written and
+// the hash of the chunk.
+func (fs *FileFSStore) WriteFileChunk(allocationID string, fileData *FileInputData,
+	chunk io.Reader, offset int64, connectionID string) (int64, string, error) {
+
+	allocation, err := fs.SetupAllocation(allocationID, false)
+	if err != nil {
+		return 0, "", common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+
+	tempFilePath := fs.generateTempPath(allocation, fileData, connectionID)
+	dest, err := fs.openObjectFile(allocation, tempFilePath, os.O_RDWR)
+	if os.IsNotExist(err) {
+		dest, err = fs.createObjectFile(allocation, tempFilePath)
+	}
+	if err != nil {
+		return 0, "", common.NewError("file_creation_error", err.Error())
+	}
+	defer dest.Close()
+
+	h := sha1.New()
+	written, err := io.Copy(io.MultiWriter(&objectFileWriter{file: dest, offset: offset}, h), chunk)
+	if err != nil {
+		return 0, "", common.NewError("file_write_error", err.Error())
+	}
+	return written, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FinalizeFileChunks truncates the temporary file of a file uploaded in
+// parts to its uploaded size and computes its content hash and merkle root
+// the same way WriteFile does.
+func (fs *FileFSStore) FinalizeFileChunks(allocationID string, fileData *FileInputData,
+	size int64, connectionID string) (*FileOutputData, error) {
+
+	allocation, err := fs.SetupAllocation(allocationID, true)
+	if err != nil {
+		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+
+	tempFilePath := fs.generateTempPath(allocation, fileData, connectionID)
+	file, err := fs.openObjectFile(allocation, tempFilePath, os.O_RDWR)
+	if err != nil {
+		return nil, common.NewError("file_reading_error", err.Error())
+	}
+	defer file.Close()
+
+	if err = file.Truncate(size); err != nil {
+		return nil, common.NewError("file_write_error", err.Error())
+	}
+
+	fileReader, err := newObjectFileReader(file)
+	if err != nil {
+		return nil, common.NewError("file_reading_error", err.Error())
+	}
+	fileRef, mt, err := computeFileData(fileReader)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeMerkleTree(tempFilePath+MerkleTreeSuffix, mt); err != nil {
+		Logger.Error("Unable to write merkle tree of the file", zap.String("path", fileData.Path), zap.Error(err))
+	}
 	fileRef.Name = fileData.Name
 	fileRef.Path = fileData.Path
-	fileRef.MerkleRoot = mt.GetRoot()
 
 	return fileRef, nil
 }
@@ -548,38 +835,80 @@ func (fs *FileFSStore) IterateObjects(allocationID string, handler FileObjectHan
 	}
 	filepath.Walk(allocation.ObjectsPath, func(path string, info os.FileInfo, err error) error {
 		if err == nil && !info.IsDir() && !strings.HasPrefix(path, allocation.TempObjectsPath) {
-			f, err := os.Open(path)
+			rel, err := filepath.Rel(allocation.ObjectsPath, path)
 			if err != nil {
 				return nil
 			}
-			defer f.Close()
-			h := sha1.New()
-			if _, err := io.Copy(h, f); err != nil {
+			object, err := fs.getObjectInfo(allocation, path)
+			if err != nil {
 				return nil
 			}
-			handler(hex.EncodeToString(h.Sum(nil)), info.Size())
+			object.Hash = strings.Replace(rel, string(os.PathSeparator), "", -1)
+			handler(object)
 		}
 		return nil
 	})
 	return nil
 }
 
-func (fs *FileFSStore) UploadToCloud(fileHash, filePath string) error {
-	_, err := fs.Minio.FPutObject(MinioConfig.BucketName, fileHash, filePath, minio.PutObjectOptions{})
+// GetObjectInfo computes the content hash and the merkle root of the object
+// stored under the hash in the allocation.
+func (fs *FileFSStore) GetObjectInfo(allocationID string, hash string) (*ObjectInfo, error) {
+	allocation, err := fs.SetupAllocation(allocationID, true)
 	if err != nil {
-		return err
+		return nil, common.NewError("filestore_setup_error", "Error setting the fs store. "+err.Error())
+	}
+	dirPath, destFile := GetFilePathFromHash(hash)
+	object, err := fs.getObjectInfo(allocation, filepath.Join(allocation.ObjectsPath, dirPath, destFile))
+	if err != nil {
+		return nil, err
 	}
+	object.Hash = hash
+	return object, nil
+}
 
-	return nil
+func (fs *FileFSStore) getObjectInfo(allocation *StoreAllocation, path string) (*ObjectInfo, error) {
+	f, err := fs.openObjectFile(allocation, path, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fileReader, err := newObjectFileReader(f)
+	if err != nil {
+		return nil, err
+	}
+	fileData, _, err := computeFileData(fileReader)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		ContentHash: fileData.ContentHash,
+		MerkleRoot:  fileData.MerkleRoot,
+		Size:        fileData.Size,
+	}, nil
 }
 
-func (fs *FileFSStore) DownloadFromCloud(fileHash, filePath string) error {
-	return fs.Minio.FGetObject(MinioConfig.BucketName, fileHash, filePath, minio.GetObjectOptions{})
+func (fs *FileFSStore) UploadToCloud(allocationID, fileHash, filePath string) error {
+	if fs.ColdTier == nil {
+		return errColdStorageDisabled
+	}
+	return fs.ColdTier.Upload(fs.contentKey(allocationID, fileHash), filePath)
 }
 
-func (fs *FileFSStore) RemoveFromCloud(fileHash string) error {
-	if _, err := fs.Minio.StatObject(MinioConfig.BucketName, fileHash, minio.StatObjectOptions{}); err == nil {
-		return fs.Minio.RemoveObject(MinioConfig.BucketName, fileHash)
+func (fs *FileFSStore) DownloadFromCloud(allocationID, fileHash, filePath string) error {
+	if fs.ColdTier == nil {
+		return errColdStorageDisabled
 	}
-	return nil
+	return fs.ColdTier.Download(fs.contentKey(allocationID, fileHash), filePath)
+}
+
+func (fs *FileFSStore) RemoveFromCloud(allocationID, fileHash string) error {
+	if fs.ColdTier == nil {
+		return errColdStorageDisabled
+	}
+	key := fs.contentKey(allocationID, fileHash)
+	if fs.coldCache != nil {
+		fs.coldCache.delete(key)
+	}
+	return fs.ColdTier.Remove(key)
 }
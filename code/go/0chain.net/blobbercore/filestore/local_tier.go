@@ -0,0 +1,75 @@
+package filestore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// localTier is a cold tier storing the contents in a local directory,
+// usually a mount of a network or a slower disk.
+type localTier struct {
+	path string
+}
+
+func newLocalTier(path string) *localTier {
+	if err := createDirs(path); err != nil {
+		Logger.Panic("Unable to create the cold storage directory", zap.String("path", path), zap.Error(err))
+		panic(err)
+	}
+	return &localTier{path: path}
+}
+
+func (lt *localTier) contentPath(hash string) string {
+	dirPath, destFile := GetFilePathFromHash(hash)
+	return filepath.Join(lt.path, dirPath, destFile)
+}
+
+func (lt *localTier) Upload(hash, filePath string) error {
+	return copyFileAtomic(filePath, lt.contentPath(hash))
+}
+
+func (lt *localTier) Download(hash, filePath string) error {
+	return copyFileAtomic(lt.contentPath(hash), filePath)
+}
+
+func (lt *localTier) Remove(hash string) error {
+	err := os.Remove(lt.contentPath(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// copyFileAtomic copies the file, the destination never holds a partial
+// copy since the tiers may be on different file systems.
+func copyFileAtomic(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err = createDirs(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	tmpPath := dst + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
@@ -0,0 +1,53 @@
+package filestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"0chain.net/core/encryption"
+)
+
+func TestLocalTier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coldtier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var tier ColdTier = newLocalTier(filepath.Join(dir, "cold"))
+	data := []byte("cold content")
+	hash := encryption.Hash(data)
+
+	srcPath := filepath.Join(dir, "src")
+	if err = ioutil.WriteFile(srcPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = tier.Upload(hash, srcPath); err != nil {
+		t.Fatal(err)
+	}
+
+	dstPath := filepath.Join(dir, "objects", "dst")
+	if err = tier.Download(hash, dstPath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got content %q, want %q", got, data)
+	}
+
+	if err = tier.Remove(hash); err != nil {
+		t.Fatal(err)
+	}
+	if err = tier.Remove(hash); err != nil {
+		t.Errorf("removing a missing content: %v", err)
+	}
+	if err = tier.Download(hash, dstPath); err == nil {
+		t.Error("expected error downloading a removed content")
+	}
+}
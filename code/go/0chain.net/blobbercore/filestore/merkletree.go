@@ -0,0 +1,105 @@
+package filestore
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"0chain.net/core/common"
+	"0chain.net/core/util"
+)
+
+const (
+	MerkleTreesDirName = "merkle"
+	MerkleTreeSuffix   = ".merkle"
+
+	// merkleLeavesCount is the number of leaves of the merkle tree of a file,
+	// each of them hashes the 64 bytes at the same offset of every block.
+	merkleLeavesCount = 1024
+	merkleChunkSize   = CHUNK_SIZE / merkleLeavesCount
+)
+
+// merkleTreeFile is the content of a merkle tree sidecar of an object.
+type merkleTreeFile struct {
+	LeavesCount int      `json:"leaves_count"`
+	Tree        []string `json:"tree"`
+}
+
+// merkleTreePath returns the sidecar path of the merkle tree of the object
+// with the given content hash.
+func (fs *FileFSStore) merkleTreePath(allocation *StoreAllocation, hash string) string {
+	dirPath, destFile := GetFilePathFromHash(hash)
+	return filepath.Join(allocation.Path, MerkleTreesDirName, dirPath, destFile)
+}
+
+// writeMerkleTree writes the levels of the merkle tree to the sidecar path,
+// replacing it atomically.
+func writeMerkleTree(path string, mt util.MerkleTreeI) error {
+	data, err := json.Marshal(&merkleTreeFile{
+		LeavesCount: merkleLeavesCount,
+		Tree:        mt.GetTree(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = createDirs(filepath.Dir(path)); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// readMerkleTree reads the merkle tree sidecar. The tree is rejected if it
+// is malformed or its inner nodes don't match its leaves.
+func readMerkleTree(path string) (util.MerkleTreeI, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mtf merkleTreeFile
+	if err = json.Unmarshal(data, &mtf); err != nil {
+		return nil, err
+	}
+	var mt util.MerkleTreeI = &util.MerkleTree{}
+	if err = mt.SetTree(mtf.LeavesCount, mtf.Tree); err != nil {
+		return nil, err
+	}
+
+	leaves := make([]util.Hashable, mtf.LeavesCount)
+	for idx := range leaves {
+		leaves[idx] = util.NewStringHashable(mtf.Tree[idx])
+	}
+	var check util.MerkleTreeI = &util.MerkleTree{}
+	check.ComputeTree(leaves)
+	checkTree := check.GetTree()
+	for idx := range checkTree {
+		if checkTree[idx] != mtf.Tree[idx] {
+			return nil, common.NewError("merkle_tree_corrupt", "Merkle tree nodes don't match its leaves")
+		}
+	}
+	return mt, nil
+}
+
+// readChallengeBlock reads the 64 bytes hashed into the leaf at the block
+// offset from every block of the file of the given size.
+func readChallengeBlock(file io.ReaderAt, size int64, blockoffset int) ([]byte, error) {
+	var returnBytes []byte
+	buf := make([]byte, merkleChunkSize)
+	for chunk := int64(0); chunk < size; chunk += CHUNK_SIZE {
+		offset := chunk + int64(blockoffset*merkleChunkSize)
+		if offset >= size || offset >= chunk+CHUNK_SIZE {
+			continue
+		}
+		n, err := file.ReadAt(buf, offset)
+		if n == 0 && err != nil {
+			return nil, err
+		}
+		returnBytes = append(returnBytes, buf[:n]...)
+	}
+	return returnBytes, nil
+}
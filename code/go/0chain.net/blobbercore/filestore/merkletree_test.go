@@ -0,0 +1,81 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"0chain.net/core/encryption"
+	"0chain.net/core/util"
+)
+
+func TestMerkleTreeSidecar(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "merkle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	leaves := make([]util.Hashable, merkleLeavesCount)
+	for idx := range leaves {
+		leaves[idx] = util.NewStringHashable(encryption.Hash([]byte{byte(idx), byte(idx >> 8)}))
+	}
+	var mt util.MerkleTreeI = &util.MerkleTree{}
+	mt.ComputeTree(leaves)
+
+	path := filepath.Join(rootDir, "sub", "dir", "object"+MerkleTreeSuffix)
+	if err = writeMerkleTree(path, mt); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readMerkleTree(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.GetRoot() != mt.GetRoot() {
+		t.Errorf("got root %s, want %s", read.GetRoot(), mt.GetRoot())
+	}
+
+	// an inner node not matching the leaves is rejected
+	var mtf merkleTreeFile
+	data, _ := ioutil.ReadFile(path)
+	if err = json.Unmarshal(data, &mtf); err != nil {
+		t.Fatal(err)
+	}
+	mtf.Tree[len(mtf.Tree)-1] = encryption.Hash("corrupt")
+	data, _ = json.Marshal(&mtf)
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readMerkleTree(path); err == nil {
+		t.Error("expected the corrupt merkle tree to be rejected")
+	}
+}
+
+func TestReadChallengeBlock(t *testing.T) {
+	// one full block and a last block shorter than the challenged offset
+	data := make([]byte, CHUNK_SIZE+merkleChunkSize+10)
+	for idx := range data {
+		data[idx] = byte(idx / merkleChunkSize)
+	}
+
+	block, err := readChallengeBlock(bytes.NewReader(data), int64(len(data)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte{}, data[merkleChunkSize:2*merkleChunkSize]...),
+		data[CHUNK_SIZE+merkleChunkSize:]...)
+	if !bytes.Equal(block, want) {
+		t.Errorf("got %d bytes, want %d bytes", len(block), len(want))
+	}
+
+	block, err = readChallengeBlock(bytes.NewReader(data), int64(len(data)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block, data[2*merkleChunkSize:3*merkleChunkSize]) {
+		t.Errorf("got %d bytes, want %d bytes", len(block), merkleChunkSize)
+	}
+}
@@ -0,0 +1,74 @@
+package filestore
+
+import (
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+
+	"0chain.net/blobbercore/config"
+
+	"github.com/minio/minio-go"
+)
+
+type MinioConfiguration struct {
+	StorageServiceURL string
+	AccessKeyID       string
+	SecretAccessKey   string
+	BucketName        string
+	BucketLocation    string
+}
+
+var MinioConfig MinioConfiguration
+
+// minioTier is a cold tier storing the contents in an S3 compatible bucket.
+type minioTier struct {
+	client *minio.Client
+	bucket string
+}
+
+func newMinioTier() *minioTier {
+	minioClient, err := minio.New(
+		MinioConfig.StorageServiceURL,
+		MinioConfig.AccessKeyID,
+		MinioConfig.SecretAccessKey,
+		config.Configuration.MinioUseSSL,
+	)
+	if err != nil {
+		Logger.Panic("Unable to initiaze minio cliet", zap.Error(err))
+		panic(err)
+	}
+
+	checkBucket(minioClient, MinioConfig.BucketName)
+	return &minioTier{client: minioClient, bucket: MinioConfig.BucketName}
+}
+
+func checkBucket(minioClient *minio.Client, bucketName string) {
+	err := minioClient.MakeBucket(bucketName, MinioConfig.BucketLocation)
+	if err != nil {
+		Logger.Error("Error with make bucket, Will check if bucket exists", zap.Error(err))
+		exists, errBucketExists := minioClient.BucketExists(bucketName)
+		if errBucketExists == nil && exists {
+			Logger.Info("We already own ", zap.Any("bucket_name", bucketName))
+		} else {
+			Logger.Error("Minio bucket error", zap.Error(errBucketExists), zap.Any("bucket_name", bucketName))
+			panic(errBucketExists)
+		}
+	} else {
+		Logger.Info(bucketName + " bucket successfully created")
+	}
+}
+
+func (mt *minioTier) Upload(hash, filePath string) error {
+	_, err := mt.client.FPutObject(mt.bucket, hash, filePath, minio.PutObjectOptions{})
+	return err
+}
+
+func (mt *minioTier) Download(hash, filePath string) error {
+	return mt.client.FGetObject(mt.bucket, hash, filePath, minio.GetObjectOptions{})
+}
+
+func (mt *minioTier) Remove(hash string) error {
+	if _, err := mt.client.StatObject(mt.bucket, hash, minio.StatObjectOptions{}); err == nil {
+		return mt.client.RemoveObject(mt.bucket, hash)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package filestore
 
 import (
 	"encoding/json"
+	"io"
 	"mime/multipart"
 
 	"0chain.net/core/util"
@@ -24,22 +25,42 @@ type FileOutputData struct {
 	Size        int64
 }
 
-type FileObjectHandler func(contentHash string, contentSize int64)
+// ObjectInfo describes an object stored under the objects path of an
+// allocation. Hash is the hash the object is stored under, ContentHash and
+// MerkleRoot are computed from its content.
+type ObjectInfo struct {
+	Hash        string
+	ContentHash string
+	MerkleRoot  string
+	Size        int64
+}
+
+type FileObjectHandler func(object *ObjectInfo)
 
 type FileStore interface {
 	WriteFile(allocationID string, fileData *FileInputData, infile multipart.File, connectionID string) (*FileOutputData, error)
+	WriteFileChunk(allocationID string, fileData *FileInputData, chunk io.Reader, offset int64, connectionID string) (int64, string, error)
+	FinalizeFileChunks(allocationID string, fileData *FileInputData, size int64, connectionID string) (*FileOutputData, error)
 	DeleteTempFile(allocationID string, fileData *FileInputData, connectionID string) error
 	GetFileBlock(allocationID string, fileData *FileInputData, blockNum int64, numBlocks int64) ([]byte, error)
+	GetFileBlockReader(allocationID string, fileData *FileInputData, blockNum int64, numBlocks int64) (io.ReadCloser, int64, error)
 	CommitWrite(allocationID string, fileData *FileInputData, connectionID string) (bool, error)
 	//GetMerkleTreeForFile(allocationID string, fileData *FileInputData) (util.MerkleTreeI, error)
 	GetFileBlockForChallenge(allocationID string, fileData *FileInputData, blockoffset int) (json.RawMessage, util.MerkleTreeI, error)
 	DeleteFile(allocationID string, contentHash string) error
+	ReleaseObject(allocationID string, hash string) error
 	GetTotalDiskSizeUsed() (int64, error)
 	GetlDiskSizeUsed(allocationID string) (int64, error)
+	GetTotalLogicalDiskSizeUsed() (int64, error)
+	GetLogicalDiskSizeUsed(allocationID string) (int64, error)
 	GetTempPathSize(allocationID string) (int64, error)
 	IterateObjects(allocationID string, handler FileObjectHandler) error
-	UploadToCloud(fileHash, filePath string) error
-	DownloadFromCloud(fileHash, filePath string) error
+	GetObjectInfo(allocationID string, hash string) (*ObjectInfo, error)
+	UploadToCloud(allocationID, fileHash, filePath string) error
+	DownloadFromCloud(allocationID, fileHash, filePath string) error
+	RemoveFromCloud(allocationID, fileHash string) error
+	PromoteFromCloud(allocationID string, hash string) error
+	RestoreFromCloud(allocationID string, hash string) error
 	SetupAllocation(allocationID string, skipCreate bool) (*StoreAllocation, error)
 }
 
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+const MAX_BATCH_OPERATIONS = 10000
+
+// BatchOperation is an operation of a batch, with the parameters of the
+// endpoint of the operation.
+type BatchOperation struct {
+	Operation  string                `json:"operation"`
+	Path       string                `json:"path"`
+	PathHash   string                `json:"path_hash,omitempty"`
+	NewName    string                `json:"new_name,omitempty"`
+	Dest       string                `json:"dest,omitempty"`
+	Attributes *reference.Attributes `json:"attributes,omitempty"`
+}
+
+type BatchOperationResult struct {
+	Operation    string `json:"operation"`
+	Path         string `json:"path"`
+	Success      bool   `json:"success"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// BatchResult is the result of a batch. The operations are added to the
+// connection only if all of them are valid.
+type BatchResult struct {
+	Success bool                    `json:"success"`
+	Results []*BatchOperationResult `json:"results"`
+}
+
+// batchState tracks the paths changed by the operations validated so far,
+// for the operations of a batch to be validated against each other. The
+// paths not changed by the batch are looked up with getRef.
+type batchState struct {
+	removed map[string]bool
+	added   map[string]string // type of the ref added at the path
+	getRef  func(path string) *reference.Ref
+}
+
+func newBatchState(getRef func(path string) *reference.Ref) *batchState {
+	return &batchState{removed: make(map[string]bool), added: make(map[string]string), getRef: getRef}
+}
+
+func (bs *batchState) isRemoved(path string) bool {
+	for ; path != "/" && path != "."; path = filepath.Dir(path) {
+		if bs.removed[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// exists tells whether there's a ref at the path, stored or added by the
+// batch, and its type.
+func (bs *batchState) exists(path string) (string, bool) {
+	if refType, ok := bs.added[path]; ok || bs.isRemoved(path) {
+		return refType, ok
+	}
+	ref := bs.getRef(path)
+	if ref == nil {
+		return "", false
+	}
+	return ref.Type, true
+}
+
+// remove removes the ref at the path, with the refs added under it.
+func (bs *batchState) remove(path string) {
+	bs.removed[path] = true
+	for added := range bs.added {
+		if added == path || strings.HasPrefix(added, path+"/") {
+			delete(bs.added, added)
+		}
+	}
+}
+
+// isDir tells whether the path is a directory, stored or added by the batch.
+func (bs *batchState) isDir(path string) bool {
+	refType, ok := bs.exists(path)
+	return ok && refType == reference.DIRECTORY
+}
+
+// addDirs adds the directory at the path with its missing parents, failing
+// if a file is in the way.
+func (bs *batchState) addDirs(path string) error {
+	for dir := path; dir != "/"; dir = filepath.Dir(dir) {
+		if refType, ok := bs.exists(dir); ok && refType != reference.DIRECTORY {
+			return common.NewError("invalid_parameters", "Invalid path. A file exists at "+dir)
+		}
+	}
+	for dir := path; dir != "/"; dir = filepath.Dir(dir) {
+		bs.added[dir] = reference.DIRECTORY
+	}
+	return nil
+}
+
+// BatchOperations adds a list of rename, copy, move, delete, update_attrs
+// and createdir operations to a connection at once. All the operations are
+// validated first, none is added if any of them is invalid. The
+// preconditions of the request apply to the whole batch.
+func (fsh *StorageHandler) BatchOperations(ctx context.Context, r *http.Request) (*BatchResult, error) {
+	if r.Method != http.MethodPost {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || (allocationObj.OwnerID != clientID && allocationObj.PayerID != clientID) {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
+	}
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
+
+	var operations []*BatchOperation
+	if err = json.Unmarshal([]byte(r.FormValue("operations")), &operations); err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid operations. "+err.Error())
+	}
+	if len(operations) == 0 || len(operations) > MAX_BATCH_OPERATIONS {
+		return nil, common.NewErrorf("invalid_parameters", "A batch should have from 1 to %d operations", MAX_BATCH_OPERATIONS)
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	state := newBatchState(func(path string) *reference.Ref {
+		ref, _ := reference.GetReference(ctx, allocationObj.ID, path)
+		return ref
+	})
+	result := &BatchResult{Success: true, Results: make([]*BatchOperationResult, len(operations))}
+	changes := make([]*allocation.AllocationChange, len(operations))
+	processors := make([]allocation.AllocationChangeProcessor, len(operations))
+	for i, op := range operations {
+		result.Results[i] = &BatchOperationResult{Operation: op.Operation, Path: op.Path}
+		changes[i], processors[i], err = fsh.batchChange(ctx, allocationObj, clientID, connectionObj, op, state)
+		if err != nil {
+			result.Results[i].ErrorMessage = err.Error()
+			result.Success = false
+			continue
+		}
+		result.Results[i].Success = true
+	}
+	if !result.Success {
+		return result, nil
+	}
+
+	for i, change := range changes {
+		connectionObj.Size += change.Size
+		connectionObj.AddChange(change, processors[i])
+	}
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+	return result, nil
+}
+
+// batchChange validates an operation of a batch the same as its endpoint
+// does, and returns its change.
+func (fsh *StorageHandler) batchChange(ctx context.Context, allocationObj *allocation.Allocation, clientID string,
+	connectionObj *allocation.AllocationChangeCollector, op *BatchOperation, state *batchState) (
+	*allocation.AllocationChange, allocation.AllocationChangeProcessor, error) {
+
+	if op.Operation != allocation.DELETE_OPERATION && allocationObj.OwnerID != clientID {
+		return nil, nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	change := &allocation.AllocationChange{ConnectionID: connectionObj.ConnectionID, Operation: op.Operation}
+
+	if op.Operation == allocation.CREATEDIR_OPERATION {
+		path := filepath.Clean(op.Path)
+		if !filepath.IsAbs(path) || path == "/" {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid path")
+		}
+		if err := state.addDirs(path); err != nil {
+			return nil, nil, err
+		}
+		return change, &allocation.CreateDirChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, Path: path}, nil
+	}
+
+	pathHash := op.PathHash
+	if len(pathHash) == 0 {
+		if len(op.Path) == 0 {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid path")
+		}
+		pathHash = reference.GetReferenceLookup(allocationObj.ID, op.Path)
+	}
+	objectRef, err := reference.GetReferenceFromLookupHash(ctx, allocationObj.ID, pathHash)
+	if err != nil || state.isRemoved(objectRef.Path) {
+		return nil, nil, common.NewError("invalid_parameters", "Invalid file path. Object does not exist.")
+	}
+
+	switch op.Operation {
+	case allocation.RENAME_OPERATION:
+		if len(op.NewName) == 0 || op.NewName == "." || op.NewName == ".." || strings.Contains(op.NewName, "/") {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid name")
+		}
+		newPath := filepath.Join(filepath.Dir(objectRef.Path), op.NewName)
+		if _, ok := state.exists(newPath); ok {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid name. Object Already exists.")
+		}
+		state.remove(objectRef.Path)
+		state.added[newPath] = objectRef.Type
+		return change, &allocation.RenameFileChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, Path: objectRef.Path, NewName: op.NewName}, nil
+
+	case allocation.COPY_OPERATION, allocation.MOVE_OPERATION:
+		if len(op.Dest) == 0 {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid destination for operation")
+		}
+		destPath := filepath.Clean(op.Dest)
+		if op.Operation == allocation.MOVE_OPERATION &&
+			(objectRef.Path == "/" || destPath == objectRef.Path || strings.HasPrefix(destPath, objectRef.Path+"/")) {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid destination path. Can't move a directory into itself.")
+		}
+		newPath := filepath.Join(destPath, objectRef.Name)
+		if _, ok := state.exists(newPath); ok {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid destination path. Object Already exists.")
+		}
+		if !state.isDir(destPath) {
+			return nil, nil, common.NewError("invalid_parameters", "Invalid destination path. Should be a valid directory.")
+		}
+		state.added[newPath] = objectRef.Type
+		if op.Operation == allocation.COPY_OPERATION {
+			change.Size = objectRef.Size
+			return change, &allocation.CopyFileChange{ConnectionID: connectionObj.ConnectionID,
+				AllocationID: connectionObj.AllocationID, SrcPath: objectRef.Path, DestPath: destPath}, nil
+		}
+		state.remove(objectRef.Path)
+		return change, &allocation.MoveFileChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, SrcPath: objectRef.Path, DestPath: destPath}, nil
+
+	case allocation.DELETE_OPERATION:
+		state.remove(objectRef.Path)
+		change.Size = 0 - objectRef.Size
+		return change, &allocation.DeleteFileChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, Name: objectRef.Name,
+			Hash: objectRef.Hash, Path: objectRef.Path, Size: objectRef.Size}, nil
+
+	case allocation.UPDATE_ATTRS_OPERATION:
+		if op.Attributes == nil {
+			return nil, nil, common.NewError("invalid_parameters", "Missing new attributes, pass at least {} for empty attributes")
+		}
+		if err = op.Attributes.Validate(); err != nil {
+			return nil, nil, err
+		}
+		return change, &allocation.AttributesChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, Path: objectRef.Path, Attributes: op.Attributes}, nil
+	}
+	return nil, nil, common.NewError("invalid_operation", "Unsupported operation "+op.Operation)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"testing"
+
+	"0chain.net/blobbercore/reference"
+)
+
+func TestBatchState(t *testing.T) {
+	// refs stored before the batch
+	stored := map[string]string{
+		"/":     reference.DIRECTORY,
+		"/a":    reference.DIRECTORY,
+		"/a/f":  reference.FILE,
+		"/d":    reference.DIRECTORY,
+		"/file": reference.FILE,
+	}
+	getRef := func(path string) *reference.Ref {
+		if refType, ok := stored[path]; ok {
+			return &reference.Ref{Path: path, Type: refType}
+		}
+		return nil
+	}
+
+	type check struct {
+		path    string
+		removed bool
+		exists  bool
+		dir     bool
+	}
+	tests := []struct {
+		name   string
+		apply  func(bs *batchState) error
+		fail   bool
+		checks []check
+	}{
+		{
+			name: "rename then move",
+			apply: func(bs *batchState) error {
+				bs.remove("/a/f") // rename /a/f to g
+				bs.added["/a/g"] = reference.FILE
+				bs.remove("/a/g") // move /a/g to /d
+				bs.added["/d/g"] = reference.FILE
+				return nil
+			},
+			checks: []check{
+				{path: "/a/f", removed: true},
+				{path: "/a/g", removed: true},
+				{path: "/d/g", exists: true},
+				{path: "/a", exists: true, dir: true},
+			},
+		},
+		{
+			name: "delete a moved source",
+			apply: func(bs *batchState) error {
+				bs.remove("/a") // move /a to /d
+				bs.added["/d/a"] = reference.DIRECTORY
+				return nil
+			},
+			checks: []check{
+				{path: "/a", removed: true},
+				{path: "/a/f", removed: true},
+				{path: "/d/a", exists: true, dir: true},
+			},
+		},
+		{
+			name: "file in the middle of a createdir path",
+			apply: func(bs *batchState) error {
+				return bs.addDirs("/file/x/y")
+			},
+			fail: true,
+			checks: []check{
+				{path: "/file", exists: true},
+				{path: "/file/x"},
+				{path: "/file/x/y"},
+			},
+		},
+		{
+			name: "renamed file in the middle of a createdir path",
+			apply: func(bs *batchState) error {
+				bs.remove("/a/f") // rename /a/f to h
+				bs.added["/a/h"] = reference.FILE
+				return bs.addDirs("/a/h/x")
+			},
+			fail: true,
+			checks: []check{
+				{path: "/a/h", exists: true},
+				{path: "/a/h/x"},
+			},
+		},
+		{
+			name: "createdir in place of a deleted file",
+			apply: func(bs *batchState) error {
+				bs.remove("/file")
+				return bs.addDirs("/file/x")
+			},
+			checks: []check{
+				{path: "/file", removed: true, exists: true, dir: true},
+				{path: "/file/x", removed: true, exists: true, dir: true},
+			},
+		},
+		{
+			name: "createdir under a deleted directory",
+			apply: func(bs *batchState) error {
+				bs.remove("/a")
+				return bs.addDirs("/a/x")
+			},
+			checks: []check{
+				{path: "/a", removed: true, exists: true, dir: true},
+				{path: "/a/f", removed: true},
+				{path: "/a/x", removed: true, exists: true, dir: true},
+			},
+		},
+		{
+			name: "delete a directory created by the batch",
+			apply: func(bs *batchState) error {
+				if err := bs.addDirs("/d/x/y"); err != nil {
+					return err
+				}
+				bs.remove("/d/x")
+				return nil
+			},
+			checks: []check{
+				{path: "/d", exists: true, dir: true},
+				{path: "/d/x", removed: true},
+				{path: "/d/x/y", removed: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		bs := newBatchState(getRef)
+		if err := tt.apply(bs); (err != nil) != tt.fail {
+			t.Errorf("%s: got error %v, want failure %v", tt.name, err, tt.fail)
+		}
+		for _, c := range tt.checks {
+			if removed := bs.isRemoved(c.path); removed != c.removed {
+				t.Errorf("%s: %s: got removed %v, want %v", tt.name, c.path, removed, c.removed)
+			}
+			if _, exists := bs.exists(c.path); exists != c.exists {
+				t.Errorf("%s: %s: got exists %v, want %v", tt.name, c.path, exists, c.exists)
+			}
+			if dir := bs.isDir(c.path); dir != c.dir {
+				t.Errorf("%s: %s: got dir %v, want %v", tt.name, c.path, dir, c.dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/encryption"
+)
+
+// CommitDryRunResult is the result a commit of a connection would have. The
+// allocation root is computed for the timestamp, and the hashes are the
+// ones of the refs loaded by the changes, as the reference paths clients
+// compute the allocation root from, and of the paths changed with their
+// parents. A path removed by the changes has an empty hash. The size delta
+// includes the sizes of the file versions retained or released.
+type CommitDryRunResult struct {
+	AllocationRoot string            `json:"allocation_root"`
+	RootHash       string            `json:"root_hash"`
+	Timestamp      common.Timestamp  `json:"timestamp"`
+	SizeDelta      int64             `json:"size_delta"`
+	Hashes         map[string]string `json:"hashes"`
+}
+
+// dryRunCommit applies the changes of the connection in a transaction of its
+// own, always rolled back. The timestamp of the write marker to sign is
+// passed as the timestamp param, now by default.
+func dryRunCommit(ctx context.Context, r *http.Request, allocationObj *allocation.Allocation,
+	connectionObj *allocation.AllocationChangeCollector) (*CommitDryRunResult, error) {
+
+	timestamp := common.Now()
+	if timestampStr := r.FormValue("timestamp"); len(timestampStr) != 0 {
+		ts, err := strconv.ParseInt(timestampStr, 10, 64)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid timestamp, should be a unix timestamp")
+		}
+		timestamp = common.Timestamp(ts)
+	}
+
+	dctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(dctx)
+	defer db.Rollback()
+
+	// the versions retained or released by the changes are accounted in the
+	// used size as the changes are applied
+	sizeUsed, err := allocation.GetBlobberSizeUsed(dctx, allocationObj.ID)
+	if err != nil {
+		return nil, common.NewError("dry_run_error", "Error reading the allocation size. "+err.Error())
+	}
+
+	paths := make(map[string]bool)
+	for idx, change := range connectionObj.Changes {
+		rootRef, err := connectionObj.AllocationChanges[idx].ProcessChange(dctx, change, "")
+		if err != nil {
+			return nil, err
+		}
+		collectRefPaths(rootRef, paths)
+		for _, path := range changePaths(connectionObj.AllocationChanges[idx]) {
+			addPathWithParents(path, paths)
+		}
+	}
+
+	rootRef, err := reference.GetReference(dctx, allocationObj.ID, "/")
+	if err != nil {
+		return nil, err
+	}
+	sizeUsedAfter, err := allocation.GetBlobberSizeUsed(dctx, allocationObj.ID)
+	if err != nil {
+		return nil, common.NewError("dry_run_error", "Error reading the allocation size. "+err.Error())
+	}
+
+	pathList := make([]string, 0, len(paths))
+	for path := range paths {
+		pathList = append(pathList, path)
+	}
+	var refs []*reference.Ref
+	err = db.Select("path, hash").Where("allocation_id = ? AND path IN (?)", allocationObj.ID, pathList).Find(&refs).Error
+	if err != nil {
+		return nil, common.NewError("dry_run_error", "Error reading the ref hashes. "+err.Error())
+	}
+
+	result := &CommitDryRunResult{
+		AllocationRoot: encryption.Hash(rootRef.Hash + ":" + strconv.FormatInt(int64(timestamp), 10)),
+		RootHash:       rootRef.Hash,
+		Timestamp:      timestamp,
+		SizeDelta:      connectionObj.Size + sizeUsedAfter - sizeUsed,
+		Hashes:         refHashes(paths, refs),
+	}
+	return result, nil
+}
+
+// refHashes returns the hashes of the refs at the paths, empty for the paths
+// with no ref.
+func refHashes(paths map[string]bool, refs []*reference.Ref) map[string]string {
+	hashes := make(map[string]string, len(paths))
+	for path := range paths {
+		hashes[path] = ""
+	}
+	for _, ref := range refs {
+		hashes[ref.Path] = ref.Hash
+	}
+	return hashes
+}
+
+// changePaths returns the paths changed by a change: the path deleted, or
+// the old and the new path of a renamed, moved or copied ref.
+func changePaths(change allocation.AllocationChangeProcessor) []string {
+	switch c := change.(type) {
+	case *allocation.DeleteFileChange:
+		return []string{c.Path}
+	case *allocation.RenameFileChange:
+		return []string{c.Path, filepath.Join(filepath.Dir(c.Path), c.NewName)}
+	case *allocation.MoveFileChange:
+		return []string{c.SrcPath, filepath.Join(c.DestPath, filepath.Base(c.SrcPath))}
+	case *allocation.CopyFileChange:
+		return []string{filepath.Join(c.DestPath, filepath.Base(c.SrcPath))}
+	}
+	return nil
+}
+
+// addPathWithParents adds the path and the paths of its parent directories.
+func addPathWithParents(path string, paths map[string]bool) {
+	path = filepath.Clean(path)
+	for ; path != "/" && path != "."; path = filepath.Dir(path) {
+		paths[path] = true
+	}
+	paths["/"] = true
+}
+
+// collectRefPaths adds the paths of the ref and of its loaded descendants.
+func collectRefPaths(ref *reference.Ref, paths map[string]bool) {
+	if ref == nil {
+		return
+	}
+	paths[ref.Path] = true
+	for _, child := range ref.Children {
+		collectRefPaths(child, paths)
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/reference"
+)
+
+func TestDryRunPaths(t *testing.T) {
+	// the processed changes return no tree for the delete, the tree of the
+	// rename is loaded from the root
+	changes := []allocation.AllocationChangeProcessor{
+		&allocation.DeleteFileChange{Path: "/a/b/deleted"},
+		&allocation.RenameFileChange{Path: "/c/old", NewName: "new"},
+		&allocation.MoveFileChange{SrcPath: "/c/moved", DestPath: "/d"},
+		&allocation.CopyFileChange{SrcPath: "/c/copied", DestPath: "/e"},
+		&allocation.CreateDirChange{Path: "/f"},
+	}
+	trees := []*reference.Ref{
+		nil,
+		{Path: "/", Children: []*reference.Ref{{Path: "/c", Children: []*reference.Ref{{Path: "/c/new"}}}}},
+		nil,
+		nil,
+		{Path: "/", Children: []*reference.Ref{{Path: "/f"}}},
+	}
+
+	paths := make(map[string]bool)
+	for i, change := range changes {
+		collectRefPaths(trees[i], paths)
+		for _, path := range changePaths(change) {
+			addPathWithParents(path, paths)
+		}
+	}
+
+	// refs left after the changes
+	refs := []*reference.Ref{
+		{Path: "/", Hash: "root"},
+		{Path: "/a", Hash: "a"},
+		{Path: "/a/b", Hash: "b"},
+		{Path: "/c", Hash: "c"},
+		{Path: "/c/new", Hash: "new"},
+		{Path: "/d", Hash: "d"},
+		{Path: "/d/moved", Hash: "moved"},
+		{Path: "/e", Hash: "e"},
+		{Path: "/e/copied", Hash: "copied"},
+		{Path: "/f", Hash: "f"},
+	}
+	want := map[string]string{
+		"/":            "root",
+		"/a":           "a",
+		"/a/b":         "b",
+		"/a/b/deleted": "",
+		"/c":           "c",
+		"/c/old":       "",
+		"/c/new":       "new",
+		"/c/moved":     "",
+		"/d":           "d",
+		"/d/moved":     "moved",
+		"/e":           "e",
+		"/e/copied":    "copied",
+		"/f":           "f",
+	}
+	if got := refHashes(paths, refs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got hashes %v, want %v", got, want)
+	}
+}
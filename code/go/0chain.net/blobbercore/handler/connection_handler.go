@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ConnectionChangeResult struct {
+	ID        int64           `json:"id"`
+	Operation string          `json:"operation"`
+	Size      int64           `json:"size"`
+	Input     json.RawMessage `json:"input"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ConnectionResult is an open connection, with its queued changes if
+// requested. The size is the sum of the sizes of its changes.
+type ConnectionResult struct {
+	ConnectionID string                    `json:"connection_id"`
+	ClientID     string                    `json:"client_id"`
+	Size         int64                     `json:"size"`
+	NumChanges   int                       `json:"num_changes"`
+	Changes      []*ConnectionChangeResult `json:"changes,omitempty"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	UpdatedAt    time.Time                 `json:"updated_at"`
+}
+
+type ConnectionsResult struct {
+	Connections []*ConnectionResult `json:"connections"`
+}
+
+func newConnectionResult(connectionObj *allocation.AllocationChangeCollector, withChanges bool) *ConnectionResult {
+	result := &ConnectionResult{
+		ConnectionID: connectionObj.ConnectionID,
+		ClientID:     connectionObj.ClientID,
+		Size:         connectionObj.Size,
+		NumChanges:   len(connectionObj.Changes),
+		CreatedAt:    connectionObj.CreatedAt,
+		UpdatedAt:    connectionObj.UpdatedAt,
+	}
+	if !withChanges {
+		return result
+	}
+	result.Changes = make([]*ConnectionChangeResult, len(connectionObj.Changes))
+	for idx, change := range connectionObj.Changes {
+		result.Changes[idx] = &ConnectionChangeResult{
+			ID:        change.ChangeID,
+			Operation: change.Operation,
+			Size:      change.Size,
+			Input:     json.RawMessage(change.Input),
+			CreatedAt: change.CreatedAt,
+		}
+	}
+	return result
+}
+
+// ListConnections lists the open connections of the allocation, only the
+// ones of the client_id passed if any. It's for the owner of the allocation
+// only.
+func (fsh *StorageHandler) ListConnections(ctx context.Context, r *http.Request) (*ConnectionsResult, error) {
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, true)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	connections, err := allocation.GetOpenConnections(ctx, allocationObj.ID, r.FormValue("client_id"))
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading the connections. "+err.Error())
+	}
+	result := &ConnectionsResult{Connections: make([]*ConnectionResult, len(connections))}
+	for idx, connectionObj := range connections {
+		result.Connections[idx] = newConnectionResult(connectionObj, false)
+	}
+	return result, nil
+}
+
+// ConnectionOperation shows an open connection of the allocation with its
+// changes with GET, or aborts it with DELETE, deleting its temp files. It's
+// for the owner of the allocation only.
+func (fsh *StorageHandler) ConnectionOperation(ctx context.Context, r *http.Request) (*ConnectionResult, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use GET / DELETE instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, r.Method == http.MethodGet)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	if r.Method == http.MethodDelete {
+		// not aborted while committed, nor while changes are added
+		allocationMutex := lock.GetMutex(allocationObj.TableName(), allocationObj.ID)
+		allocationMutex.Lock()
+		defer allocationMutex.Unlock()
+		mutex := lock.GetMutex(allocation.AllocationChangeCollector{}.TableName(), connectionID)
+		mutex.Lock()
+		defer mutex.Unlock()
+	}
+
+	connectionObj, err := allocation.GetOpenConnection(ctx, allocationObj.ID, connectionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id. Connection not found or not open")
+	}
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	if r.Method == http.MethodDelete {
+		Logger.Info("Aborting the connection", zap.Any("connection", connectionID))
+		if err = deleteConnection(ctx, connectionObj); err != nil {
+			return nil, common.NewError("connection_write_error", "Error deleting the connection. "+err.Error())
+		}
+	}
+	return newConnectionResult(connectionObj, true), nil
+}
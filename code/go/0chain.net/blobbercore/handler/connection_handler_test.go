@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"0chain.net/blobbercore/allocation"
+)
+
+func TestNewConnectionResult(t *testing.T) {
+	connectionObj := &allocation.AllocationChangeCollector{
+		ConnectionID: "conn",
+		ClientID:     "client",
+		Size:         30,
+		Changes: []*allocation.AllocationChange{
+			{ChangeID: 1, Operation: allocation.INSERT_OPERATION, Size: 50, Input: `{"path":"/a"}`},
+			{ChangeID: 2, Operation: allocation.DELETE_OPERATION, Size: -20, Input: `{"path":"/b"}`},
+		},
+	}
+
+	result := newConnectionResult(connectionObj, false)
+	if result.ConnectionID != "conn" || result.ClientID != "client" || result.Size != 30 ||
+		result.NumChanges != 2 || result.Changes != nil {
+		t.Fatalf("unexpected result without changes: %+v", result)
+	}
+
+	result = newConnectionResult(connectionObj, true)
+	if len(result.Changes) != 2 {
+		t.Fatalf("unexpected changes: %+v", result.Changes)
+	}
+	for idx, change := range result.Changes {
+		expected := connectionObj.Changes[idx]
+		if change.ID != expected.ChangeID || change.Operation != expected.Operation || change.Size != expected.Size {
+			t.Errorf("change %d: %+v", idx, change)
+		}
+	}
+	// the inputs are embedded as JSON, not as strings
+	b, err := json.Marshal(result.Changes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Input map[string]string `json:"input"`
+	}
+	if err = json.Unmarshal(b, &decoded); err != nil || decoded.Input["path"] != "/b" {
+		t.Errorf("unexpected input in %s: %v", b, err)
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// DirResult is the result of a directory operation.
+type DirResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DirOperation creates a directory with POST, or deletes a directory with its
+// whole subtree with DELETE, within a connection.
+func (fsh *StorageHandler) DirOperation(ctx context.Context, r *http.Request) (*DirResult, error) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST / DELETE instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+
+	if len(clientID) == 0 {
+		return nil, common.NewError("invalid_operation", "Invalid client")
+	}
+	if r.Method == http.MethodPost && allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+	if allocationObj.OwnerID != clientID && allocationObj.PayerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
+	}
+
+	path := r.FormValue("path")
+	if len(path) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid path")
+	}
+	path = filepath.Clean(path)
+	if !filepath.IsAbs(path) || path == "/" {
+		return nil, common.NewError("invalid_parameters", "Invalid path")
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dirRef, _ := reference.GetReference(ctx, allocationObj.ID, path)
+	if dirRef != nil && dirRef.Type != reference.DIRECTORY {
+		return nil, common.NewError("invalid_parameters", "Invalid path. Not a directory.")
+	}
+
+	allocationChange := &allocation.AllocationChange{}
+	allocationChange.ConnectionID = connectionObj.ConnectionID
+	result := &DirResult{Path: path}
+	if r.Method == http.MethodPost {
+		allocationChange.Operation = allocation.CREATEDIR_OPERATION
+		connectionObj.AddChange(allocationChange, &allocation.CreateDirChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, Path: path})
+	} else {
+		if dirRef == nil {
+			return nil, common.NewError("invalid_parameters", "Directory does not exist at path")
+		}
+		// the space of all the files of the subtree is released
+		allocationChange.Size = 0 - dirRef.Size
+		allocationChange.Operation = allocation.DELETE_OPERATION
+		connectionObj.Size += allocationChange.Size
+		connectionObj.AddChange(allocationChange, &allocation.DeleteFileChange{ConnectionID: connectionObj.ConnectionID,
+			AllocationID: connectionObj.AllocationID, Name: dirRef.Name,
+			Hash: dirRef.Hash, Path: dirRef.Path, Size: dirRef.Size})
+		result.Size = dirRef.Size
+	}
+
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	return result, nil
+}
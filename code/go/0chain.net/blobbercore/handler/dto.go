@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"sync"
+
 	"0chain.net/blobbercore/allocation"
 	"0chain.net/blobbercore/readmarker"
 	"0chain.net/blobbercore/reference"
@@ -20,6 +22,13 @@ type CommitResult struct {
 	Success        bool                           `json:"success"`
 	ErrorMessage   string                         `json:"error_msg,omitempty"`
 	Changes        []*allocation.AllocationChange `json:"-"`
+	// DryRun is the result of the commit, not done, with dry_run
+	DryRun *CommitDryRunResult `json:"dry_run,omitempty"`
+	// the commit to finish once the transaction is committed, with the lock
+	// of the allocation held until then
+	journal    *allocation.CommitJournalEntry
+	connection *allocation.AllocationChangeCollector
+	mutex      *sync.Mutex
 	//Result         []*UploadResult         `json:"result"`
 }
 
@@ -43,6 +52,13 @@ type ListResult struct {
 	AllocationRoot string                   `json:"allocation_root"`
 	Meta           map[string]interface{}   `json:"meta_data"`
 	Entities       []map[string]interface{} `json:"list"`
+	NextCursor     string                   `json:"next_cursor,omitempty"`
+}
+
+type SearchResult struct {
+	AllocationRoot string                   `json:"allocation_root"`
+	Entities       []map[string]interface{} `json:"list"`
+	NextCursor     string                   `json:"next_cursor,omitempty"`
 }
 
 type DownloadResponse struct {
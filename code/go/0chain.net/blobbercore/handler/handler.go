@@ -30,12 +30,24 @@ func GetMetaDataStore() *datastore.Store {
 func SetupHandlers(r *mux.Router) {
 	//object operations
 	r.HandleFunc("/v1/file/upload/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(UploadHandler))))
+	r.HandleFunc("/v1/file/upload/session/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(UploadSessionHandler))))
+	r.HandleFunc("/v1/file/upload/chunk/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(UploadChunkHandler))))
+	r.HandleFunc("/v1/file/upload/finalize/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(FinalizeUploadHandler))))
 	r.HandleFunc("/v1/file/download/{allocation}", common.UserRateLimit(common.ToByteStream(WithConnection(DownloadHandler))))
 	r.HandleFunc("/v1/file/rename/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(RenameHandler))))
 	r.HandleFunc("/v1/file/copy/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(CopyHandler))))
+	r.HandleFunc("/v1/file/move/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(MoveHandler))))
+	r.HandleFunc("/v1/dir/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(DirHandler))))
+	r.HandleFunc("/v1/file/batch/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(BatchHandler))))
+	r.HandleFunc("/v1/file/restoreversion/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(RestoreVersionHandler))))
+	r.HandleFunc("/v1/trash/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(TrashHandler))))
+	r.HandleFunc("/v1/trash/restore/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(RestoreTrashHandler))))
 	r.HandleFunc("/v1/file/attributes/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(UpdateAttributesHandler))))
+	r.HandleFunc("/v1/file/xattrs/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(UpdateXAttrsHandler))))
 
-	r.HandleFunc("/v1/connection/commit/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(CommitHandler))))
+	r.HandleFunc("/v1/connection/commit/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithFinishCommit(WithConnection(CommitHandler)))))
+	r.HandleFunc("/v1/connection/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(ConnectionHandler))))
+	r.HandleFunc("/v1/connections/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ListConnectionsHandler))))
 	r.HandleFunc("/v1/file/commitmetatxn/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(CommitMetaTxnHandler))))
 	r.HandleFunc("/v1/file/collaborator/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(CollaboratorHandler))))
 	r.HandleFunc("/v1/file/calculatehash/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithConnection(CalculateHashHandler))))
@@ -45,6 +57,10 @@ func SetupHandlers(r *mux.Router) {
 	r.HandleFunc("/v1/file/meta/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(FileMetaHandler))))
 	r.HandleFunc("/v1/file/stats/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(FileStatsHandler))))
 	r.HandleFunc("/v1/file/list/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ListHandler))))
+	r.HandleFunc("/v1/file/versions/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(FileVersionsHandler))))
+	r.HandleFunc("/v1/file/search/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(SearchHandler))))
+	r.HandleFunc("/v1/file/diff/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(DiffHandler))))
+	r.HandleFunc("/v1/writemarkers/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(WriteMarkersHandler))))
 	r.HandleFunc("/v1/file/objectpath/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ObjectPathHandler))))
 	r.HandleFunc("/v1/file/referencepath/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ReferencePathHandler))))
 	r.HandleFunc("/v1/file/objecttree/{allocation}", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(ObjectTreeHandler))))
@@ -54,6 +70,7 @@ func SetupHandlers(r *mux.Router) {
 	r.HandleFunc("/_config", common.UserRateLimit(common.ToJSONResponse(GetConfig)))
 	r.HandleFunc("/_stats", common.UserRateLimit(stats.StatsHandler))
 	r.HandleFunc("/_statsJSON", common.UserRateLimit(common.ToJSONResponse(stats.StatsJSONHandler)))
+	r.HandleFunc("/_scrubstats", common.UserRateLimit(common.ToJSONResponse(stats.ScrubStatsHandler)))
 	r.HandleFunc("/_cleanupdisk", common.UserRateLimit(common.ToJSONResponse(WithReadOnlyConnection(CleanupDiskHandler))))
 	r.HandleFunc("/getstats", common.UserRateLimit(common.ToJSONResponse(stats.GetStatsHandler)))
 }
@@ -177,6 +194,42 @@ func DownloadHandler(ctx context.Context, r *http.Request) (interface{}, error)
 	return response, nil
 }
 
+/*FileVersionsHandler is the handler to list the versions kept for a file*/
+func FileVersionsHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+
+	response, err := storageHandler.ListFileVersions(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*RestoreVersionHandler is the handler to restore a version kept for a file*/
+func RestoreVersionHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+
+	response, err := storageHandler.RestoreVersion(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*SearchHandler is the handler to respond to search requests from clients*/
+func SearchHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+
+	response, err := storageHandler.SearchEntities(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 /*ListHandler is the handler to respond to upload requests fro clients*/
 func ListHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	ctx = setupHandlerContext(ctx, r)
@@ -254,6 +307,104 @@ func CopyHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	return response, nil
 }
 
+func MoveHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.MoveObject(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*BatchHandler is the handler to add many operations to a connection at once*/
+func BatchHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.BatchOperations(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*DirHandler is the handler to create and delete directories*/
+func DirHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.DirOperation(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*TrashHandler is the handler to list and empty the trash*/
+func TrashHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.TrashOperation(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*RestoreTrashHandler is the handler to restore an object from the trash*/
+func RestoreTrashHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.RestoreFromTrash(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*WriteMarkersHandler is the handler to list the write markers of an allocation*/
+func WriteMarkersHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.ListWriteMarkers(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*DiffHandler is the handler to list the paths changed between two allocation roots*/
+func DiffHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.DiffAllocationRoots(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*ConnectionHandler is the handler to show and abort open connections*/
+func ConnectionHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.ConnectionOperation(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*ListConnectionsHandler is the handler to list the open connections of an allocation*/
+func ListConnectionsHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.ListConnections(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 /*UploadHandler is the handler to respond to upload requests fro clients*/
 func UploadHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	ctx = setupHandlerContext(ctx, r)
@@ -265,6 +416,39 @@ func UploadHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	return response, nil
 }
 
+/*UploadSessionHandler is the handler to open upload sessions of files uploaded in chunks and to report their progress*/
+func UploadSessionHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.OpenUploadSession(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*UploadChunkHandler is the handler to respond to chunk upload requests of upload sessions*/
+func UploadChunkHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.WriteFileChunk(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+/*FinalizeUploadHandler is the handler to finalize upload sessions*/
+func FinalizeUploadHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.FinalizeUploadSession(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 func UpdateAttributesHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	ctx = setupHandlerContext(ctx, r)
 	response, err := storageHandler.UpdateObjectAttributes(ctx, r)
@@ -275,6 +459,17 @@ func UpdateAttributesHandler(ctx context.Context, r *http.Request) (interface{},
 	return response, nil
 }
 
+/*UpdateXAttrsHandler is the handler to set and remove the xattrs of files and directories*/
+func UpdateXAttrsHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = setupHandlerContext(ctx, r)
+	response, err := storageHandler.UpdateXAttrs(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
 func CalculateHashHandler(ctx context.Context, r *http.Request) (interface{}, error) {
 	ctx = setupHandlerContext(ctx, r)
 
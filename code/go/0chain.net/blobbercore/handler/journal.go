@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/core/common"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// WithFinishCommit commits the changes of the connection committed by the
+// handler to the file store, once the transaction of the handler is
+// committed and before the allocation is unlocked. A commit it can't finish
+// is left in the journal, retried by the commit journal worker.
+func WithFinishCommit(handler common.JSONResponderF) common.JSONResponderF {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		resp, err := handler(ctx, r)
+		result, ok := resp.(*CommitResult)
+		if ok && result.mutex != nil {
+			defer result.mutex.Unlock()
+		}
+		if err != nil {
+			return resp, err
+		}
+		if !ok || result.journal == nil {
+			return resp, nil
+		}
+		if err = allocation.FinishCommit(ctx, result.journal, result.connection); err != nil {
+			Logger.Error("Error committing to file store, left to the retry",
+				zap.Any("connection", result.journal.ConnectionID), zap.Error(err))
+		}
+		return resp, nil
+	}
+}
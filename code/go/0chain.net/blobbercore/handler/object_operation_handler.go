@@ -5,10 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"0chain.net/blobbercore/allocation"
 	"0chain.net/blobbercore/config"
@@ -221,27 +223,35 @@ func (fsh *StorageHandler) DownloadFile(ctx context.Context, r *http.Request) (
 		pathHash = reference.GetReferenceLookup(allocationID, path)
 	}
 
-	var blockNumStr = r.FormValue("block_num")
-	if len(blockNumStr) == 0 {
-		return nil, common.NewError("download_file", "no block number")
-	}
+	var (
+		rangeHeader = r.Header.Get("Range")
+		blockNum    int64
+		numBlocks   int64
+	)
 
-	var blockNum int64
-	blockNum, err = strconv.ParseInt(blockNumStr, 10, 64)
-	if err != nil || blockNum < 0 {
-		return nil, common.NewError("download_file", "invalid block number")
-	}
+	// with a Range header the blocks are derived from the requested
+	// byte range once the file size is known
+	if len(rangeHeader) == 0 {
+		var blockNumStr = r.FormValue("block_num")
+		if len(blockNumStr) == 0 {
+			return nil, common.NewError("download_file", "no block number")
+		}
 
-	var numBlocksStr = r.FormValue("num_blocks")
-	if len(numBlocksStr) == 0 {
-		numBlocksStr = "1"
-	}
+		blockNum, err = strconv.ParseInt(blockNumStr, 10, 64)
+		if err != nil || blockNum < 0 {
+			return nil, common.NewError("download_file", "invalid block number")
+		}
 
-	var numBlocks int64
-	numBlocks, err = strconv.ParseInt(numBlocksStr, 10, 64)
-	if err != nil || numBlocks < 0 {
-		return nil, common.NewError("download_file",
-			"invalid number of blocks")
+		var numBlocksStr = r.FormValue("num_blocks")
+		if len(numBlocksStr) == 0 {
+			numBlocksStr = "1"
+		}
+
+		numBlocks, err = strconv.ParseInt(numBlocksStr, 10, 64)
+		if err != nil || numBlocks < 0 {
+			return nil, common.NewError("download_file",
+				"invalid number of blocks")
+		}
 	}
 
 	var (
@@ -275,6 +285,48 @@ func (fsh *StorageHandler) DownloadFile(ctx context.Context, r *http.Request) (
 			"path is not a file: %v", err)
 	}
 
+	// a version kept for the file is downloaded instead of its current
+	// content if requested, by the owner, the payer or a collaborator
+	if versionStr := r.FormValue("version"); len(versionStr) > 0 {
+		if allocationObj.OwnerID != clientID && allocationObj.PayerID != clientID &&
+			!reference.IsACollaborator(ctx, fileref.ID, clientID) {
+			return nil, common.NewError("download_file",
+				"versions can only be downloaded by the owner, the payer or a collaborator")
+		}
+		var version int64
+		if version, err = strconv.ParseInt(versionStr, 10, 64); err != nil {
+			return nil, common.NewError("download_file", "invalid version")
+		}
+		var fileVersion *reference.FileVersion
+		if fileVersion, err = reference.GetFileVersion(ctx, fileref.ID, version); err != nil {
+			return nil, common.NewErrorf("download_file", "%v", err)
+		}
+		fileref.ContentHash = fileVersion.ContentHash
+		fileref.MerkleRoot = fileVersion.MerkleRoot
+		fileref.Size = fileVersion.Size
+		fileref.ThumbnailHash = fileVersion.ThumbnailHash
+		fileref.ThumbnailSize = fileVersion.ThumbnailSize
+		fileref.OnCloud = fileVersion.OnCloud
+	}
+
+	var downloadMode = r.FormValue("content")
+
+	var byteRange *httpRange
+	if len(rangeHeader) > 0 {
+		var size = fileref.Size
+		if downloadMode == DOWNLOAD_CONTENT_THUMB {
+			size = fileref.ThumbnailSize
+		}
+		if byteRange, err = parseRange(rangeHeader, size); err != nil {
+			return nil, err
+		}
+		if byteRange != nil {
+			blockNum, numBlocks = byteRange.blocks()
+		} else {
+			blockNum, numBlocks = wholeBlocks(size)
+		}
+	}
+
 	var (
 		authTokenString       = r.FormValue("auth_token")
 		clientIDForReadRedeem = clientID // default payer is client
@@ -367,35 +419,31 @@ func (fsh *StorageHandler) DownloadFile(ctx context.Context, r *http.Request) (
 
 	// reading allowed
 
-	var (
-		downloadMode = r.FormValue("content")
-		respData     []byte
-	)
+	var fileData = &filestore.FileInputData{}
+	fileData.Name = fileref.Name
+	fileData.Path = fileref.Path
+	fileData.Hash = fileref.ContentHash
+	fileData.OnCloud = fileref.OnCloud
 	if len(downloadMode) > 0 && downloadMode == DOWNLOAD_CONTENT_THUMB {
-		var fileData = &filestore.FileInputData{}
-		fileData.Name = fileref.Name
-		fileData.Path = fileref.Path
 		fileData.Hash = fileref.ThumbnailHash
-		fileData.OnCloud = fileref.OnCloud
-		respData, err = filestore.GetFileStore().GetFileBlock(allocationID,
-			fileData, blockNum, numBlocks)
-		if err != nil {
-			return nil, common.NewErrorf("download_file",
-				"couldn't get thumbnail block: %v", err)
-		}
-	} else {
-		var fileData = &filestore.FileInputData{}
-		fileData.Name = fileref.Name
-		fileData.Path = fileref.Path
-		fileData.Hash = fileref.ContentHash
-		fileData.OnCloud = fileref.OnCloud
-		respData, err = filestore.GetFileStore().GetFileBlock(allocationID,
-			fileData, blockNum, numBlocks)
+	}
+
+	// the blocks are streamed to the client once the read marker is saved
+	var (
+		respData io.ReadCloser
+		respSize int64
+	)
+	respData, respSize, err = filestore.GetFileStore().GetFileBlockReader(
+		allocationID, fileData, blockNum, numBlocks)
+	if err != nil {
+		return nil, common.NewErrorf("download_file",
+			"couldn't get file block: %v", err)
+	}
+	defer func() {
 		if err != nil {
-			return nil, common.NewErrorf("download_file",
-				"couldn't get file block: %v", err)
+			respData.Close()
 		}
-	}
+	}()
 
 	readMarker.PayerID = clientIDForReadRedeem
 	err = readmarker.SaveLatestReadMarker(ctx, readMarker, latestRM == nil)
@@ -407,12 +455,15 @@ func (fsh *StorageHandler) DownloadFile(ctx context.Context, r *http.Request) (
 	var response = &DownloadResponse{}
 	response.Success = true
 	response.LatestRM = readMarker
-	response.Data = respData
 	response.Path = fileref.Path
 	response.AllocationID = fileref.AllocationID
 
 	stats.FileBlockDownloaded(ctx, fileref.ID)
-	return respData, nil
+	stats.FileAccessed(ctx, fileref.ID, fileref.OnCloud)
+	if byteRange != nil {
+		return byteRange.content(respData, respSize)
+	}
+	return &common.ByteStream{Data: respData, Size: respSize}, nil
 }
 
 func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*CommitResult, error) {
@@ -437,9 +488,25 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*C
 		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
 	}
 
+	// the lock is held by the result of a commit, until it's finished
+	var result CommitResult
 	mutex := lock.GetMutex(allocationObj.TableName(), allocationID)
 	mutex.Lock()
-	defer mutex.Unlock()
+	defer func() {
+		if result.mutex == nil {
+			mutex.Unlock()
+		}
+	}()
+
+	// reloaded under the lock, as committed by the commits before, for the
+	// preconditions and the allocation root of the write marker
+	allocationObj, err = allocation.GetAllocationByID(ctx, allocationID)
+	if err != nil {
+		return nil, common.NewError("allocation_read_error", "Error reading the allocation. "+err.Error())
+	}
+	if err = allocationObj.LoadTerms(ctx); err != nil {
+		return nil, common.NewError("allocation_read_error", "Error reading the allocation terms. "+err.Error())
+	}
 
 	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationID, clientID)
 	if err != nil {
@@ -478,11 +545,23 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*C
 		return nil, common.NewError("request_parse_error", err.Error())
 	}
 
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
+
 	if allocationObj.BlobberSizeUsed+connectionObj.Size > allocationObj.BlobberSize {
 		return nil, common.NewError("max_allocation_size",
 			"Max size reached for the allocation with this blobber")
 	}
 
+	if r.FormValue("dry_run") == "true" {
+		dryRun, err := dryRunCommit(ctx, r, allocationObj, connectionObj)
+		if err != nil {
+			return nil, err
+		}
+		return &CommitResult{AllocationRoot: allocationObj.AllocationRoot, Success: true, DryRun: dryRun}, nil
+	}
+
 	writeMarkerString := r.FormValue("write_marker")
 	writeMarker := writemarker.WriteMarker{}
 	err = json.Unmarshal([]byte(writeMarkerString), &writeMarker)
@@ -492,7 +571,6 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*C
 			err)
 	}
 
-	var result CommitResult
 	var latestWM *writemarker.WriteMarkerEntity
 	if len(allocationObj.AllocationRoot) == 0 {
 		latestWM = nil
@@ -532,6 +610,16 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*C
 	if err != nil {
 		return nil, err
 	}
+	// the versions retained by the changes are accounted in the used size by
+	// now, on top of the size of the connection
+	sizeUsed, err := allocation.GetBlobberSizeUsed(ctx, allocationID)
+	if err != nil {
+		return nil, common.NewError("allocation_read_error", "Error reading the allocation size. "+err.Error())
+	}
+	if sizeUsed+connectionObj.Size > allocationObj.BlobberSize {
+		return nil, common.NewError("max_allocation_size",
+			"Max size reached for the allocation with this blobber, with the file versions retained")
+	}
 	rootRef, err := reference.GetReference(ctx, allocationID, "/")
 	if err != nil {
 		return nil, err
@@ -553,6 +641,11 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*C
 	if err != nil {
 		return nil, common.NewError("write_marker_error", "Error persisting the write marker")
 	}
+	if keep := config.Configuration.HistoryWriteMarkers; keep > 0 {
+		if err = writemarker.PruneHistory(ctx, allocationObj.ID, keep); err != nil {
+			return nil, common.NewError("write_marker_error", "Error pruning the history. "+err.Error())
+		}
+	}
 
 	db := datastore.GetStore().GetTransaction(ctx)
 	allocationUpdates := make(map[string]interface{})
@@ -565,15 +658,17 @@ func (fsh *StorageHandler) CommitWrite(ctx context.Context, r *http.Request) (*C
 	if err != nil {
 		return nil, common.NewError("allocation_write_error", "Error persisting the allocation object")
 	}
-	err = connectionObj.CommitToFileStore(ctx)
+	// the files are moved once the transaction is committed, by
+	// WithFinishCommit or by the recovery at startup after a crash
+	result.journal, err = allocation.AddCommitJournalEntry(ctx, connectionObj)
 	if err != nil {
-		return nil, common.NewError("file_store_error", "Error committing to file store. "+err.Error())
+		return nil, common.NewError("commit_journal_error", "Error journaling the commit. "+err.Error())
 	}
+	result.connection = connectionObj
+	result.mutex = mutex
 
 	result.Changes = connectionObj.Changes
 
-	connectionObj.DeleteChanges(ctx)
-
 	db.Model(connectionObj).Updates(allocation.AllocationChangeCollector{Status: allocation.CommittedConnection})
 
 	result.AllocationRoot = allocationObj.AllocationRoot
@@ -619,6 +714,9 @@ func (fsh *StorageHandler) RenameObject(ctx context.Context, r *http.Request) (i
 	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
 		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
 	}
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
 
 	connectionID := r.FormValue("connection_id")
 	if len(connectionID) == 0 {
@@ -704,6 +802,9 @@ func (fsh *StorageHandler) UpdateObjectAttributes(ctx context.Context,
 		return nil, common.NewErrorf("update_object_attributes",
 			"decoding given attributes: %v", err)
 	}
+	if err = attrs.Validate(); err != nil {
+		return nil, err
+	}
 
 	var (
 		pathHash = r.FormValue("path_hash")
@@ -807,6 +908,9 @@ func (fsh *StorageHandler) CopyObject(ctx context.Context, r *http.Request) (int
 	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
 		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
 	}
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
 
 	connectionID := r.FormValue("connection_id")
 	if len(connectionID) == 0 {
@@ -863,6 +967,105 @@ func (fsh *StorageHandler) CopyObject(ctx context.Context, r *http.Request) (int
 	return result, nil
 }
 
+// MoveObject moves a file or a directory to another directory without
+// copying the objects.
+func (fsh *StorageHandler) MoveObject(ctx context.Context, r *http.Request) (interface{}, error) {
+	if r.Method == "GET" {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+	_ = ctx.Value(constants.CLIENT_KEY_CONTEXT_KEY).(string)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+
+	allocationID := allocationObj.ID
+
+	if len(clientID) == 0 {
+		return nil, common.NewError("invalid_operation", "Invalid client")
+	}
+
+	destPath := r.FormValue("dest")
+	if len(destPath) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid destination for operation")
+	}
+	destPath = filepath.Clean(destPath)
+
+	path_hash := r.FormValue("path_hash")
+	path := r.FormValue("path")
+	if len(path_hash) == 0 {
+		if len(path) == 0 {
+			return nil, common.NewError("invalid_parameters", "Invalid path")
+		}
+		path_hash = reference.GetReferenceLookup(allocationID, path)
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	objectRef, err := reference.GetReferenceFromLookupHash(ctx, allocationID, path_hash)
+
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid file path. "+err.Error())
+	}
+	if objectRef.Path == "/" || destPath == objectRef.Path || strings.HasPrefix(destPath, objectRef.Path+"/") {
+		return nil, common.NewError("invalid_parameters", "Invalid destination path. Can't move a directory into itself.")
+	}
+	newPath := filepath.Join(destPath, objectRef.Name)
+	destRef, _ := reference.GetReference(ctx, allocationID, newPath)
+	if destRef != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid destination path. Object Already exists.")
+	}
+
+	destRef, err = reference.GetReference(ctx, allocationID, destPath)
+	if err != nil || destRef.Type != reference.DIRECTORY {
+		return nil, common.NewError("invalid_parameters", "Invalid destination path. Should be a valid directory.")
+	}
+
+	allocationChange := &allocation.AllocationChange{}
+	allocationChange.ConnectionID = connectionObj.ConnectionID
+	allocationChange.Size = 0
+	allocationChange.Operation = allocation.MOVE_OPERATION
+	dfc := &allocation.MoveFileChange{ConnectionID: connectionObj.ConnectionID,
+		AllocationID: connectionObj.AllocationID, DestPath: destPath}
+	dfc.SrcPath = objectRef.Path
+	connectionObj.Size += allocationChange.Size
+	connectionObj.AddChange(allocationChange, dfc)
+
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	result := &UploadResult{}
+	result.Filename = objectRef.Name
+	result.Hash = objectRef.Hash
+	result.MerkleRoot = objectRef.MerkleRoot
+	result.Size = objectRef.Size
+
+	return result, nil
+}
+
 func (fsh *StorageHandler) DeleteFile(ctx context.Context, r *http.Request, connectionObj *allocation.AllocationChangeCollector) (*UploadResult, error) {
 	path := r.FormValue("path")
 	if len(path) == 0 {
@@ -918,11 +1121,19 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*Upl
 		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
 	}
 
+	if err = checkIfMatch(r, allocationObj); err != nil {
+		return nil, err
+	}
+
 	if err = r.ParseMultipartForm(FORM_FILE_PARSE_MAX_MEMORY); nil != err {
 		Logger.Info("Error Parsing the request", zap.Any("error", err))
 		return nil, common.NewError("request_parse_error", err.Error())
 	}
 
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
+
 	connectionID := r.FormValue("connection_id")
 	if len(connectionID) == 0 {
 		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
@@ -965,31 +1176,16 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*Upl
 			return nil, common.NewError("invalid_parameters",
 				"Invalid parameters. Error parsing the meta data for upload."+err.Error())
 		}
-		exisitingFileRef := fsh.checkIfFileAlreadyExists(ctx, allocationID, formData.Path)
-		existingFileRefSize := int64(0)
-		exisitingFileOnCloud := false
-		if mode == allocation.INSERT_OPERATION {
-			if allocationObj.OwnerID != clientID && allocationObj.PayerID != clientID {
-				return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
-			}
-
-			if exisitingFileRef != nil {
-				return nil, common.NewError("duplicate_file", "File at path already exists")
-			}
-		} else if mode == allocation.UPDATE_OPERATION {
-			if exisitingFileRef == nil {
-				return nil, common.NewError("invalid_file_update", "File at path does not exist for update")
-			}
-
-			if allocationObj.OwnerID != clientID &&
-				allocationObj.PayerID != clientID &&
-				!reference.IsACollaborator(ctx, exisitingFileRef.ID, clientID) {
-				return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner, collaborator or the payer of the allocation")
-			}
+		if err = formData.Attributes.Validate(); err != nil {
+			return nil, err
+		}
+		exisitingFileRef, err := fsh.checkUploadAccess(ctx, allocationObj, clientID, mode, formData.Path)
+		if err != nil {
+			return nil, err
 		}
 
+		exisitingFileOnCloud := false
 		if exisitingFileRef != nil {
-			existingFileRefSize = exisitingFileRef.Size
 			exisitingFileOnCloud = exisitingFileRef.OnCloud
 		}
 
@@ -999,74 +1195,119 @@ func (fsh *StorageHandler) WriteFile(ctx context.Context, r *http.Request) (*Upl
 		}
 		defer origfile.Close()
 
-		thumbfile, thumbHeader, _ := r.FormFile("uploadThumbnailFile")
-		thumbnailPresent := false
-		if thumbHeader != nil {
-			thumbnailPresent = true
-			defer thumbfile.Close()
-		}
-
 		fileInputData := &filestore.FileInputData{Name: formData.Filename, Path: formData.Path, OnCloud: exisitingFileOnCloud}
 		fileOutputData, err := filestore.GetFileStore().WriteFile(allocationID, fileInputData, origfile, connectionObj.ConnectionID)
 		if err != nil {
 			return nil, common.NewError("upload_error", "Failed to upload the file. "+err.Error())
 		}
 
-		result.Filename = formData.Filename
-		result.Hash = fileOutputData.ContentHash
-		result.MerkleRoot = fileOutputData.MerkleRoot
-		result.Size = fileOutputData.Size
+		result, err = fsh.addUploadChange(r, allocationObj, connectionObj, mode, &formData, exisitingFileRef, fileOutputData)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	return result, nil
+}
+
+// checkUploadAccess checks the client can insert or update the file at the
+// path and returns the existing file reference, if any.
+func (fsh *StorageHandler) checkUploadAccess(ctx context.Context, allocationObj *allocation.Allocation,
+	clientID, mode, path string) (*reference.Ref, error) {
 
-		if len(formData.Hash) > 0 && formData.Hash != fileOutputData.ContentHash {
-			return nil, common.NewError("content_hash_mismatch", "Content hash provided in the meta data does not match the file content")
+	exisitingFileRef := fsh.checkIfFileAlreadyExists(ctx, allocationObj.ID, path)
+	if mode == allocation.INSERT_OPERATION {
+		if allocationObj.OwnerID != clientID && allocationObj.PayerID != clientID {
+			return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
 		}
-		if len(formData.MerkleRoot) > 0 && formData.MerkleRoot != fileOutputData.MerkleRoot {
-			return nil, common.NewError("content_merkle_root_mismatch", "Merkle root provided in the meta data does not match the file content")
+
+		if exisitingFileRef != nil {
+			return nil, common.NewError("duplicate_file", "File at path already exists")
 		}
-		if fileOutputData.Size > config.Configuration.MaxFileSize {
-			return nil, common.NewError("file_size_limit_exceeded", "Size for the given file is larger than the max limit")
+	} else if mode == allocation.UPDATE_OPERATION {
+		if exisitingFileRef == nil {
+			return nil, common.NewError("invalid_file_update", "File at path does not exist for update")
 		}
 
-		formData.Hash = fileOutputData.ContentHash
-		formData.MerkleRoot = fileOutputData.MerkleRoot
-		formData.AllocationID = allocationID
-		formData.Size = fileOutputData.Size
-
-		allocationSize := fileOutputData.Size
-		if thumbnailPresent {
-			thumbInputData := &filestore.FileInputData{Name: thumbHeader.Filename, Path: formData.Path}
-			thumbOutputData, err := filestore.GetFileStore().WriteFile(allocationID, thumbInputData, thumbfile, connectionObj.ConnectionID)
-			if err != nil {
-				return nil, common.NewError("upload_error", "Failed to upload the thumbnail. "+err.Error())
-			}
-			if len(formData.ThumbnailHash) > 0 && formData.ThumbnailHash != thumbOutputData.ContentHash {
-				return nil, common.NewError("content_hash_mismatch", "Content hash provided in the meta data does not match the thumbnail content")
-			}
-			formData.ThumbnailHash = thumbOutputData.ContentHash
-			formData.ThumbnailSize = thumbOutputData.Size
-			formData.ThumbnailFilename = thumbInputData.Name
+		if allocationObj.OwnerID != clientID &&
+			allocationObj.PayerID != clientID &&
+			!reference.IsACollaborator(ctx, exisitingFileRef.ID, clientID) {
+			return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner, collaborator or the payer of the allocation")
 		}
+	}
+	return exisitingFileRef, nil
+}
 
-		if allocationObj.BlobberSizeUsed+(allocationSize-existingFileRefSize) > allocationObj.BlobberSize {
-			return nil, common.NewError("max_allocation_size", "Max size reached for the allocation with this blobber")
-		}
+// addUploadChange verifies the stored file against its meta data, stores
+// the optional thumbnail and adds the insert or update change to the
+// connection.
+func (fsh *StorageHandler) addUploadChange(r *http.Request, allocationObj *allocation.Allocation,
+	connectionObj *allocation.AllocationChangeCollector, mode string, formData *allocation.UpdateFileChange,
+	exisitingFileRef *reference.Ref, fileOutputData *filestore.FileOutputData) (*UploadResult, error) {
 
-		allocationChange := &allocation.AllocationChange{}
-		allocationChange.ConnectionID = connectionObj.ConnectionID
-		allocationChange.Size = allocationSize - existingFileRefSize
-		allocationChange.Operation = mode
+	allocationID := allocationObj.ID
+	existingFileRefSize := int64(0)
+	if exisitingFileRef != nil {
+		existingFileRefSize = exisitingFileRef.Size
+	}
 
-		connectionObj.Size += allocationChange.Size
-		if mode == allocation.INSERT_OPERATION {
-			connectionObj.AddChange(allocationChange, &formData.NewFileChange)
-		} else if mode == allocation.UPDATE_OPERATION {
-			connectionObj.AddChange(allocationChange, &formData)
+	result := &UploadResult{}
+	result.Filename = formData.Filename
+	result.Hash = fileOutputData.ContentHash
+	result.MerkleRoot = fileOutputData.MerkleRoot
+	result.Size = fileOutputData.Size
+
+	if len(formData.Hash) > 0 && formData.Hash != fileOutputData.ContentHash {
+		return nil, common.NewError("content_hash_mismatch", "Content hash provided in the meta data does not match the file content")
+	}
+	if len(formData.MerkleRoot) > 0 && formData.MerkleRoot != fileOutputData.MerkleRoot {
+		return nil, common.NewError("content_merkle_root_mismatch", "Merkle root provided in the meta data does not match the file content")
+	}
+	if fileOutputData.Size > config.Configuration.MaxFileSize {
+		return nil, common.NewError("file_size_limit_exceeded", "Size for the given file is larger than the max limit")
+	}
+
+	formData.Hash = fileOutputData.ContentHash
+	formData.MerkleRoot = fileOutputData.MerkleRoot
+	formData.AllocationID = allocationID
+	formData.Size = fileOutputData.Size
+
+	allocationSize := fileOutputData.Size
+	thumbfile, thumbHeader, _ := r.FormFile("uploadThumbnailFile")
+	if thumbHeader != nil {
+		defer thumbfile.Close()
+		thumbInputData := &filestore.FileInputData{Name: thumbHeader.Filename, Path: formData.Path}
+		thumbOutputData, err := filestore.GetFileStore().WriteFile(allocationID, thumbInputData, thumbfile, connectionObj.ConnectionID)
+		if err != nil {
+			return nil, common.NewError("upload_error", "Failed to upload the thumbnail. "+err.Error())
 		}
+		if len(formData.ThumbnailHash) > 0 && formData.ThumbnailHash != thumbOutputData.ContentHash {
+			return nil, common.NewError("content_hash_mismatch", "Content hash provided in the meta data does not match the thumbnail content")
+		}
+		formData.ThumbnailHash = thumbOutputData.ContentHash
+		formData.ThumbnailSize = thumbOutputData.Size
+		formData.ThumbnailFilename = thumbInputData.Name
 	}
-	err = connectionObj.Save(ctx)
-	if err != nil {
-		Logger.Error("Error in writing the connection meta data", zap.Error(err))
-		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+
+	if allocationObj.BlobberSizeUsed+(allocationSize-existingFileRefSize) > allocationObj.BlobberSize {
+		return nil, common.NewError("max_allocation_size", "Max size reached for the allocation with this blobber")
+	}
+
+	allocationChange := &allocation.AllocationChange{}
+	allocationChange.ConnectionID = connectionObj.ConnectionID
+	allocationChange.Size = allocationSize - existingFileRefSize
+	allocationChange.Operation = mode
+
+	connectionObj.Size += allocationChange.Size
+	if mode == allocation.INSERT_OPERATION {
+		connectionObj.AddChange(allocationChange, &formData.NewFileChange)
+	} else if mode == allocation.UPDATE_OPERATION {
+		connectionObj.AddChange(allocationChange, formData)
 	}
 
 	return result, nil
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+
+	"gorm.io/gorm"
+)
+
+// checkIfMatch fails with precondition_failed if the allocation root isn't
+// the one passed in the If-Match header, if any. It doesn't read the body of
+// the request, so uploads fail before their data is sent.
+func checkIfMatch(r *http.Request, allocationObj *allocation.Allocation) error {
+	expected := strings.Trim(r.Header.Get("If-Match"), `"`)
+	if len(expected) == 0 || expected == "*" {
+		return nil
+	}
+	return checkAllocationRoot(allocationObj, expected)
+}
+
+func checkAllocationRoot(allocationObj *allocation.Allocation, expected string) error {
+	if expected != allocationObj.AllocationRoot {
+		return common.NewErrorf("precondition_failed",
+			"Allocation root %q isn't the expected %q", allocationObj.AllocationRoot, expected)
+	}
+	return nil
+}
+
+// checkPreconditions fails with precondition_failed if the allocation root
+// isn't the one expected, passed in the If-Match header or the
+// expected_allocation_root param, or if the hash of a ref isn't the one
+// expected. The expected hashes are passed in the expected_hashes param, a
+// JSON object of paths to hashes, an empty hash expecting no ref at the
+// path. Other connections may still be committed before the connection, the
+// commit checks the preconditions again under the allocation lock.
+func checkPreconditions(ctx context.Context, r *http.Request, allocationObj *allocation.Allocation) error {
+	if err := checkIfMatch(r, allocationObj); err != nil {
+		return err
+	}
+	if expected := r.FormValue("expected_allocation_root"); len(expected) != 0 {
+		if err := checkAllocationRoot(allocationObj, expected); err != nil {
+			return err
+		}
+	}
+
+	expectedHashesStr := r.FormValue("expected_hashes")
+	if len(expectedHashesStr) == 0 {
+		return nil
+	}
+	var expectedHashes map[string]string
+	if err := json.Unmarshal([]byte(expectedHashesStr), &expectedHashes); err != nil {
+		return common.NewError("invalid_parameters", "Invalid expected hashes. "+err.Error())
+	}
+	for path, expected := range expectedHashes {
+		var hash string
+		ref, err := reference.GetReference(ctx, allocationObj.ID, filepath.Clean(path))
+		if err == nil {
+			hash = ref.Hash
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.NewError("precondition_error", "Error reading the ref. "+err.Error())
+		}
+		if hash != expected {
+			return common.NewErrorf("precondition_failed",
+				"Hash %q of %s isn't the expected %q", hash, path, expected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"0chain.net/blobbercore/allocation"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	allocationObj := &allocation.Allocation{AllocationRoot: "root"}
+
+	tests := []struct {
+		header string
+		fail   bool
+	}{
+		{header: ""},
+		{header: "*"},
+		{header: "root"},
+		{header: `"root"`},
+		{header: "other", fail: true},
+		{header: `"other"`, fail: true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/v1/connection/commit/alloc", nil)
+		if len(tt.header) != 0 {
+			r.Header.Set("If-Match", tt.header)
+		}
+		err := checkIfMatch(r, allocationObj)
+		if tt.fail != (err != nil) {
+			t.Errorf("%q: unexpected result %v", tt.header, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"0chain.net/blobbercore/filestore"
+	"0chain.net/core/common"
+)
+
+// httpRange is a satisfiable single byte range of a Range request header.
+// Both offsets are inclusive.
+type httpRange struct {
+	start int64
+	end   int64
+	size  int64
+}
+
+// parseRange parses a "bytes=" Range header value for content of the given
+// size. Only a single range is supported, as RFC 7233 allows, a Range header
+// of another unit, with several ranges or invalid is ignored and no range
+// is returned. The error is for a range which can't be satisfied.
+func parseRange(header string, size int64) (*httpRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, nil
+	}
+	var spec = strings.TrimSpace(header[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	var i = strings.Index(spec, "-")
+	if i < 0 {
+		return nil, nil
+	}
+
+	var (
+		startStr = strings.TrimSpace(spec[:i])
+		endStr   = strings.TrimSpace(spec[i+1:])
+		hr       = &httpRange{size: size}
+		err      error
+	)
+
+	switch {
+	case len(startStr) == 0:
+		// suffix range, the last N bytes
+		var n int64
+		if n, err = strconv.ParseInt(endStr, 10, 64); err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 {
+			return nil, common.NewRangeNotSatisfiable(size,
+				"empty suffix range: %q", spec)
+		}
+		if n > size {
+			n = size
+		}
+		hr.start, hr.end = size-n, size-1
+	default:
+		if hr.start, err = strconv.ParseInt(startStr, 10, 64); err != nil ||
+			hr.start < 0 {
+			return nil, nil
+		}
+		hr.end = size - 1
+		if len(endStr) > 0 {
+			if hr.end, err = strconv.ParseInt(endStr, 10, 64); err != nil ||
+				hr.end < hr.start {
+				return nil, nil
+			}
+			if hr.end >= size {
+				hr.end = size - 1
+			}
+		}
+	}
+
+	if hr.start >= size || hr.end < hr.start {
+		return nil, common.NewRangeNotSatisfiable(size,
+			"range %q is out of file size %d", spec, size)
+	}
+	return hr, nil
+}
+
+// wholeBlocks returns the first block number and the number of blocks of
+// the whole content of the given size, sent when the Range header is
+// ignored.
+func wholeBlocks(size int64) (blockNum, numBlocks int64) {
+	numBlocks = (size + filestore.CHUNK_SIZE - 1) / filestore.CHUNK_SIZE
+	if numBlocks == 0 {
+		numBlocks = 1
+	}
+	return 1, numBlocks
+}
+
+// blocks returns the first block number and the number of blocks that
+// cover the range; the same values a client sends as block_num and
+// num_blocks, and the ones the read marker is charged for.
+func (hr *httpRange) blocks() (blockNum, numBlocks int64) {
+	var (
+		first = hr.start / filestore.CHUNK_SIZE
+		last  = hr.end / filestore.CHUNK_SIZE
+	)
+	return first + 1, last - first + 1
+}
+
+// content trims the reader of the blocks read for the range, which yields
+// size bytes, to the exact bytes requested.
+func (hr *httpRange) content(rc io.ReadCloser, size int64) (
+	*common.PartialContent, error) {
+
+	var (
+		blockNum, _ = hr.blocks()
+		skip        = hr.start - (blockNum-1)*filestore.CHUNK_SIZE
+		length      = hr.end - hr.start + 1
+	)
+	if skip > size {
+		skip = size
+	}
+	if length > size-skip {
+		length = size - skip
+	}
+	if length <= 0 {
+		rc.Close()
+		return nil, common.NewRangeNotSatisfiable(hr.size,
+			"range %d-%d is out of file content", hr.start, hr.end)
+	}
+	if _, err := io.CopyN(ioutil.Discard, rc, skip); err != nil {
+		rc.Close()
+		return nil, common.NewErrorf("download_file",
+			"couldn't seek to range start: %v", err)
+	}
+	return &common.PartialContent{
+		Data:  rc,
+		Start: hr.start,
+		End:   hr.start + length - 1,
+		Size:  hr.size,
+	}, nil
+}
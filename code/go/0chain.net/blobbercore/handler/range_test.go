@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"0chain.net/blobbercore/filestore"
+	"0chain.net/core/common"
+)
+
+func TestParseRange(t *testing.T) {
+	const size = 3*filestore.CHUNK_SIZE + 10
+
+	tests := []struct {
+		header     string
+		start, end int64
+		blockNum   int64
+		numBlocks  int64
+		fail       bool
+		ignored    bool
+	}{
+		{header: "bytes=0-0", start: 0, end: 0, blockNum: 1, numBlocks: 1},
+		{header: "bytes=0-", start: 0, end: size - 1, blockNum: 1, numBlocks: 4},
+		{header: "bytes=65535-65536", start: 65535, end: 65536, blockNum: 1, numBlocks: 2},
+		{header: "bytes=-10", start: size - 10, end: size - 1, blockNum: 4, numBlocks: 1},
+		{header: "bytes=100-999999999", start: 100, end: size - 1, blockNum: 1, numBlocks: 4},
+		{header: "bytes=-0", fail: true},
+		{header: "bytes=196618-", fail: true},
+		{header: "bytes=5-1", ignored: true},
+		{header: "bytes=0-1,4-5", ignored: true},
+		{header: "items=0-1", ignored: true},
+		{header: "bytes=abc", ignored: true},
+	}
+
+	for _, tt := range tests {
+		hr, err := parseRange(tt.header, size)
+		if tt.ignored {
+			if hr != nil || err != nil {
+				t.Errorf("%s: expected the range to be ignored, got %v, %v", tt.header, hr, err)
+			}
+			continue
+		}
+		if tt.fail {
+			rerr, ok := err.(*common.RangeNotSatisfiable)
+			if !ok || rerr.Size != size {
+				t.Errorf("%s: expected range error for size %d, got %v", tt.header, size, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.header, err)
+			continue
+		}
+		if hr.start != tt.start || hr.end != tt.end {
+			t.Errorf("%s: got range %d-%d, want %d-%d", tt.header,
+				hr.start, hr.end, tt.start, tt.end)
+		}
+		blockNum, numBlocks := hr.blocks()
+		if blockNum != tt.blockNum || numBlocks != tt.numBlocks {
+			t.Errorf("%s: got blocks %d+%d, want %d+%d", tt.header,
+				blockNum, numBlocks, tt.blockNum, tt.numBlocks)
+		}
+	}
+}
+
+func TestRangeContent(t *testing.T) {
+	var data = make([]byte, 2*filestore.CHUNK_SIZE)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	hr, err := parseRange("bytes=65530-65540", int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := hr.content(ioutil.NopCloser(bytes.NewReader(data)),
+		int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, 1)
+	if _, err = pc.Data.Read(first); err != nil {
+		t.Fatal(err)
+	}
+	if first[0] != byte(65530%256) || pc.Start != 65530 || pc.End != 65540 {
+		t.Errorf("unexpected partial content: %d-%d starting with %d",
+			pc.Start, pc.End, first[0])
+	}
+}
+
+func TestWholeBlocks(t *testing.T) {
+	tests := []struct {
+		size      int64
+		numBlocks int64
+	}{
+		{0, 1},
+		{1, 1},
+		{filestore.CHUNK_SIZE, 1},
+		{filestore.CHUNK_SIZE + 1, 2},
+		{3*filestore.CHUNK_SIZE + 10, 4},
+	}
+	for _, tt := range tests {
+		if blockNum, numBlocks := wholeBlocks(tt.size); blockNum != 1 || numBlocks != tt.numBlocks {
+			t.Errorf("size %d: got blocks %d+%d, want 1+%d", tt.size, blockNum, numBlocks, tt.numBlocks)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"0chain.net/blobbercore/stats"
 	"go.uber.org/zap"
@@ -25,6 +27,8 @@ const (
 
 	DOWNLOAD_CONTENT_FULL  = "full"
 	DOWNLOAD_CONTENT_THUMB = "thumbnail"
+
+	MAX_LIST_PAGE_SIZE = 1000
 )
 
 type StorageHandler struct{}
@@ -78,6 +82,21 @@ func (fsh *StorageHandler) verifyAuthTicket(ctx context.Context, r *http.Request
 	return true, nil
 }
 
+// historySequence returns the sequence of the write marker of the
+// allocation root passed to read the refs as of a past write marker, or 0 to
+// read the latest refs.
+func (fsh *StorageHandler) historySequence(ctx context.Context, r *http.Request, allocationObj *allocation.Allocation) (int64, error) {
+	allocationRoot := r.FormValue("allocation_root")
+	if len(allocationRoot) == 0 || allocationRoot == allocationObj.AllocationRoot {
+		return 0, nil
+	}
+	sequence, err := writemarker.GetWriteMarkerSequence(ctx, allocationObj.ID, allocationRoot)
+	if err != nil {
+		return 0, common.NewError("invalid_parameters", "Invalid allocation root. "+err.Error())
+	}
+	return sequence, nil
+}
+
 func (fsh *StorageHandler) GetAllocationDetails(ctx context.Context, r *http.Request) (interface{}, error) {
 	if r.Method != "GET" {
 		return nil, common.NewError("invalid_method", "Invalid method used. Use GET instead")
@@ -144,7 +163,17 @@ func (fsh *StorageHandler) GetFileMeta(ctx context.Context, r *http.Request) (in
 		path_hash = reference.GetReferenceLookup(allocationID, path)
 	}
 
-	fileref, err := reference.GetReferenceFromLookupHash(ctx, allocationID, path_hash)
+	sequence, err := fsh.historySequence(ctx, r, allocationObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileref *reference.Ref
+	if sequence != 0 {
+		fileref, err = reference.GetReferenceFromLookupHashAtSequence(ctx, allocationID, path_hash, sequence)
+	} else {
+		fileref, err = reference.GetReferenceFromLookupHash(ctx, allocationID, path_hash)
+	}
 
 	if err != nil {
 		return nil, common.NewError("invalid_parameters", "Invalid file path. "+err.Error())
@@ -397,6 +426,14 @@ func (fsh *StorageHandler) ListEntities(ctx context.Context, r *http.Request) (*
 	if r.Method == "POST" {
 		return nil, common.NewError("invalid_method", "Invalid method used. Use GET instead")
 	}
+	// a page is read in a single snapshot, the children listed and the
+	// allocation root returned agree. Pages are read in snapshots of their
+	// own, the next page may follow a later allocation root.
+	err := GetMetaDataStore().GetTransaction(ctx).Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").Error
+	if err != nil {
+		return nil, common.NewError("list_error", err.Error())
+	}
+
 	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
 	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
 	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, true)
@@ -410,6 +447,23 @@ func (fsh *StorageHandler) ListEntities(ctx context.Context, r *http.Request) (*
 		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
 	}
 
+	var listingOpts *reference.ListingOptions
+	if pageSize := r.FormValue("page_size"); len(pageSize) != 0 {
+		listingOpts = &reference.ListingOptions{
+			SortBy:   r.FormValue("sort_by"),
+			Desc:     r.FormValue("sort_order") == "desc",
+			Cursor:   r.FormValue("cursor"),
+			Type:     r.FormValue("type"),
+			MimeType: r.FormValue("mimetype"),
+		}
+		if listingOpts.PageSize, err = strconv.Atoi(pageSize); err != nil || listingOpts.PageSize > MAX_LIST_PAGE_SIZE {
+			return nil, common.NewErrorf("invalid_parameters", "Invalid page size, at most %d", MAX_LIST_PAGE_SIZE)
+		}
+		if err = listingOpts.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	path_hash := r.FormValue("path_hash")
 	path := r.FormValue("path")
 	if len(path_hash) == 0 {
@@ -421,7 +475,20 @@ func (fsh *StorageHandler) ListEntities(ctx context.Context, r *http.Request) (*
 
 	Logger.Info("Path Hash for list dir :" + path_hash)
 
-	fileref, err := reference.GetReferenceFromLookupHash(ctx, allocationID, path_hash)
+	sequence, err := fsh.historySequence(ctx, r, allocationObj)
+	if err != nil {
+		return nil, err
+	}
+	if sequence != 0 && listingOpts != nil {
+		return nil, common.NewError("invalid_parameters", "Listings at a past allocation root aren't paginated")
+	}
+
+	var fileref *reference.Ref
+	if sequence != 0 {
+		fileref, err = reference.GetReferenceFromLookupHashAtSequence(ctx, allocationID, path_hash, sequence)
+	} else {
+		fileref, err = reference.GetReferenceFromLookupHash(ctx, allocationID, path_hash)
+	}
 	if err != nil {
 		return nil, common.NewError("invalid_parameters", "Invalid path. "+err.Error())
 	}
@@ -436,13 +503,26 @@ func (fsh *StorageHandler) ListEntities(ctx context.Context, r *http.Request) (*
 		}
 	}
 
-	dirref, err := reference.GetRefWithChildren(ctx, allocationID, fileref.Path)
+	var dirref *reference.Ref
+	var nextCursor string
+	if sequence != 0 {
+		dirref, err = reference.GetRefWithChildrenAtSequence(ctx, allocationID, fileref.Path, sequence)
+	} else if listingOpts == nil {
+		dirref, err = reference.GetRefWithChildren(ctx, allocationID, fileref.Path)
+	} else {
+		dirref = fileref
+		dirref.Children, nextCursor, err = reference.GetChildrenPage(ctx, allocationID, fileref.Path, listingOpts)
+	}
 	if err != nil {
 		return nil, common.NewError("invalid_parameters", "Invalid path. "+err.Error())
 	}
 
 	var result ListResult
+	result.NextCursor = nextCursor
 	result.AllocationRoot = allocationObj.AllocationRoot
+	if sequence != 0 {
+		result.AllocationRoot = r.FormValue("allocation_root")
+	}
 	result.Meta = dirref.GetListingData(ctx)
 	if clientID != allocationObj.OwnerID {
 		delete(result.Meta, "path")
@@ -458,6 +538,126 @@ func (fsh *StorageHandler) ListEntities(ctx context.Context, r *http.Request) (*
 	return &result, nil
 }
 
+// SearchEntities searches the files and directories of the allocation, or of
+// the subtree at the path, by name, path prefix, mimetype, size, created or
+// updated time, and custom meta keys and xattrs given as key or key:value.
+func (fsh *StorageHandler) SearchEntities(ctx context.Context, r *http.Request) (*SearchResult, error) {
+	if r.Method == "POST" {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use GET instead")
+	}
+	// a page is read in a single snapshot, the refs listed and the
+	// allocation root returned agree. Pages are read in snapshots of their
+	// own, the next page may follow a later allocation root.
+	err := GetMetaDataStore().GetTransaction(ctx).Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").Error
+	if err != nil {
+		return nil, common.NewError("search_error", err.Error())
+	}
+
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, true)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	allocationID := allocationObj.ID
+
+	if len(clientID) == 0 {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	opts := &reference.SearchOptions{
+		PathPrefix: r.FormValue("path_prefix"),
+		Name:       r.FormValue("name"),
+		NamePrefix: r.FormValue("name_prefix"),
+		Type:       r.FormValue("type"),
+		MimeType:   r.FormValue("mimetype"),
+		Cursor:     r.FormValue("cursor"),
+		PageSize:   MAX_LIST_PAGE_SIZE,
+		CustomMeta: make(map[string]string),
+		XAttrs:     make(map[string]string),
+	}
+	intParams := map[string]*int64{"min_size": &opts.MinSize, "max_size": &opts.MaxSize}
+	for param, value := range intParams {
+		if len(r.FormValue(param)) == 0 {
+			continue
+		}
+		if *value, err = strconv.ParseInt(r.FormValue(param), 10, 64); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid "+param)
+		}
+	}
+	timeParams := map[string]*time.Time{"created_from": &opts.CreatedFrom, "created_to": &opts.CreatedTo,
+		"updated_from": &opts.UpdatedFrom, "updated_to": &opts.UpdatedTo}
+	for param, value := range timeParams {
+		if len(r.FormValue(param)) == 0 {
+			continue
+		}
+		ts, err := strconv.ParseInt(r.FormValue(param), 10, 64)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid "+param+", should be a unix timestamp")
+		}
+		*value = time.Unix(ts, 0)
+	}
+	for _, meta := range r.Form["custom_meta"] {
+		kv := strings.SplitN(meta, ":", 2)
+		opts.CustomMeta[kv[0]] = ""
+		if len(kv) == 2 {
+			opts.CustomMeta[kv[0]] = kv[1]
+		}
+	}
+	for _, xattr := range r.Form["xattr"] {
+		kv := strings.SplitN(xattr, ":", 2)
+		opts.XAttrs[kv[0]] = ""
+		if len(kv) == 2 {
+			opts.XAttrs[kv[0]] = kv[1]
+		}
+	}
+	if pageSize := r.FormValue("page_size"); len(pageSize) != 0 {
+		if opts.PageSize, err = strconv.Atoi(pageSize); err != nil || opts.PageSize > MAX_LIST_PAGE_SIZE {
+			return nil, common.NewErrorf("invalid_parameters", "Invalid page size, at most %d", MAX_LIST_PAGE_SIZE)
+		}
+	}
+
+	// the search is limited to the subtree of the ref shared by auth tickets
+	path_hash := r.FormValue("path_hash")
+	path := r.FormValue("path")
+	if len(path_hash) == 0 {
+		if len(path) == 0 {
+			path = "/"
+		}
+		path_hash = reference.GetReferenceLookup(allocationID, filepath.Clean(path))
+	}
+	rootRef, err := reference.GetReferenceFromLookupHash(ctx, allocationID, path_hash)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid path. "+err.Error())
+	}
+	authTokenString := r.FormValue("auth_token")
+	if clientID != allocationObj.OwnerID || len(authTokenString) > 0 {
+		authTicketVerified, err := fsh.verifyAuthTicket(ctx, r, allocationObj, rootRef, clientID)
+		if err != nil {
+			return nil, err
+		}
+		if !authTicketVerified {
+			return nil, common.NewError("auth_ticket_verification_failed", "Could not verify the auth ticket.")
+		}
+	}
+	opts.Path = rootRef.Path
+
+	refs, nextCursor, err := reference.SearchRefs(ctx, allocationID, opts)
+	if err != nil {
+		return nil, common.NewError("search_error", err.Error())
+	}
+
+	result := &SearchResult{AllocationRoot: allocationObj.AllocationRoot, NextCursor: nextCursor}
+	result.Entities = make([]map[string]interface{}, len(refs))
+	for idx, ref := range refs {
+		result.Entities[idx] = ref.GetListingData(ctx)
+		if clientID != allocationObj.OwnerID {
+			delete(result.Entities[idx], "path")
+		}
+	}
+	return result, nil
+}
+
 func (fsh *StorageHandler) GetReferencePath(ctx context.Context, r *http.Request) (*ReferencePathResult, error) {
 	if r.Method == "POST" {
 		return nil, common.NewError("invalid_method", "Invalid method used. Use GET instead")
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// TrashResult is a page of the trash of an allocation, latest deleted
+// first.
+type TrashResult struct {
+	Entries    []*reference.TrashEntry `json:"entries"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+type RestoreTrashResult struct {
+	ID   int64  `json:"id"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// TrashOperation lists the trash of the allocation with GET, or empties it
+// with DELETE, only the entry with the id if passed. It's for the owner of
+// the allocation only.
+func (fsh *StorageHandler) TrashOperation(ctx context.Context, r *http.Request) (*TrashResult, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use GET / DELETE instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, r.Method == http.MethodGet)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	if r.Method == http.MethodDelete {
+		return fsh.emptyTrash(ctx, r, allocationObj)
+	}
+
+	pageSize := MAX_LIST_PAGE_SIZE
+	if pageSizeStr := r.FormValue("page_size"); len(pageSizeStr) != 0 {
+		if pageSize, err = strconv.Atoi(pageSizeStr); err != nil || pageSize <= 0 || pageSize > MAX_LIST_PAGE_SIZE {
+			return nil, common.NewErrorf("invalid_parameters", "Invalid page size, at most %d", MAX_LIST_PAGE_SIZE)
+		}
+	}
+	var cursor int64
+	if cursorStr := r.FormValue("cursor"); len(cursorStr) != 0 {
+		if cursor, err = strconv.ParseInt(cursorStr, 10, 64); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid cursor")
+		}
+	}
+
+	entries, err := reference.GetTrashEntries(ctx, allocationObj.ID, cursor, pageSize+1)
+	if err != nil {
+		return nil, common.NewError("trash_error", "Error reading the trash. "+err.Error())
+	}
+	result := &TrashResult{Entries: entries}
+	if len(entries) > pageSize {
+		result.Entries = entries[:pageSize]
+		result.NextCursor = strconv.FormatInt(result.Entries[pageSize-1].ID, 10)
+	}
+	return result, nil
+}
+
+// emptyTrash purges the entry with the id passed, or the whole trash.
+func (fsh *StorageHandler) emptyTrash(ctx context.Context, r *http.Request, allocationObj *allocation.Allocation) (*TrashResult, error) {
+	mutex := lock.GetMutex(allocationObj.TableName(), allocationObj.ID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var entries []*reference.TrashEntry
+	if idStr := r.FormValue("id"); len(idStr) != 0 {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid trash entry id")
+		}
+		entry, err := reference.GetTrashEntry(ctx, allocationObj.ID, id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	} else {
+		for cursor := int64(0); ; {
+			page, err := reference.GetTrashEntries(ctx, allocationObj.ID, cursor, MAX_LIST_PAGE_SIZE)
+			if err != nil {
+				return nil, common.NewError("trash_error", "Error reading the trash. "+err.Error())
+			}
+			if len(page) == 0 {
+				break
+			}
+			entries = append(entries, page...)
+			cursor = page[len(page)-1].ID
+		}
+	}
+
+	// purged in a transaction of their own, the contents are released once
+	// it's committed
+	if err := allocation.PurgeTrashEntries(ctx, allocationObj.ID, entries); err != nil {
+		Logger.Error("Error purging the trash", zap.String("allocation", allocationObj.ID), zap.Error(err))
+		return nil, err
+	}
+	return &TrashResult{Entries: entries}, nil
+}
+
+// RestoreFromTrash adds the restore of a trash entry, to its original path
+// or to the path passed, to a connection.
+func (fsh *StorageHandler) RestoreFromTrash(ctx context.Context, r *http.Request) (*RestoreTrashResult, error) {
+	if r.Method != http.MethodPost {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid trash entry id")
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	entry, err := reference.GetTrashEntry(ctx, allocationObj.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	path := entry.Path
+	if newPath := r.FormValue("path"); len(newPath) != 0 {
+		path = filepath.Clean(newPath)
+	}
+	if !filepath.IsAbs(path) || path == "/" {
+		return nil, common.NewError("invalid_parameters", "Invalid path")
+	}
+	if ref, _ := reference.GetReference(ctx, allocationObj.ID, path); ref != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid path. Object Already exists.")
+	}
+
+	allocationChange := &allocation.AllocationChange{}
+	allocationChange.ConnectionID = connectionObj.ConnectionID
+	allocationChange.Operation = allocation.RESTORE_TRASH_OPERATION
+	allocationChange.Size = entry.Size
+	connectionObj.Size += allocationChange.Size
+	connectionObj.AddChange(allocationChange, &allocation.RestoreTrashChange{
+		ConnectionID: connectionObj.ConnectionID,
+		AllocationID: connectionObj.AllocationID,
+		EntryID:      entry.ID,
+		Path:         path,
+	})
+
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	return &RestoreTrashResult{ID: entry.ID, Path: path, Size: allocationChange.Size}, nil
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/config"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/filestore"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// OpenUploadSession opens, or reopens for resuming, a session to upload a
+// file in chunks within a connection. POST opens an insert session and PUT
+// an update session, with the meta data in uploadMeta or updateMeta the
+// same as for WriteFile. GET returns the progress of the session.
+func (fsh *StorageHandler) OpenUploadSession(ctx context.Context, r *http.Request) (*allocation.UploadSession, error) {
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+
+	if len(clientID) == 0 {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
+	}
+
+	if r.Method == "GET" {
+		session, err := allocation.GetUploadSession(ctx, r.FormValue("session_id"), allocationObj.ID, clientID)
+		if err != nil {
+			return nil, common.NewError("invalid_upload_session", "Upload session not found")
+		}
+		return session, nil
+	}
+
+	if err = checkPreconditions(ctx, r, allocationObj); err != nil {
+		return nil, err
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	mode := allocation.INSERT_OPERATION
+	formField := "uploadMeta"
+	if r.Method == "PUT" {
+		mode = allocation.UPDATE_OPERATION
+		formField = "updateMeta"
+	}
+
+	var formData allocation.UpdateFileChange
+	uploadMetaString := r.FormValue(formField)
+	if err = json.Unmarshal([]byte(uploadMetaString), &formData); err != nil {
+		return nil, common.NewError("invalid_parameters",
+			"Invalid parameters. Error parsing the meta data for upload."+err.Error())
+	}
+	if err = formData.Attributes.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err = fsh.checkUploadAccess(ctx, allocationObj, clientID, mode, formData.Path); err != nil {
+		return nil, err
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if connectionObj.Status == allocation.NewConnection {
+		if err = connectionObj.Save(ctx); err != nil {
+			Logger.Error("Error in writing the connection meta data", zap.Error(err))
+			return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+		}
+	}
+
+	sessionID := allocation.GetUploadSessionID(connectionID, formData.Path)
+	session, err := allocation.GetUploadSession(ctx, sessionID, allocationObj.ID, clientID)
+	if err == nil {
+		if session.Status != allocation.UploadSessionOpen {
+			return nil, common.NewError("invalid_upload_session", "Upload session is already finalized")
+		}
+		return session, nil // resume
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, common.NewError("meta_error", "Error reading the upload session")
+	}
+
+	session = &allocation.UploadSession{
+		SessionID:    sessionID,
+		ConnectionID: connectionID,
+		AllocationID: allocationObj.ID,
+		ClientID:     clientID,
+		Operation:    mode,
+		Path:         formData.Path,
+		Filename:     formData.Filename,
+		UploadMeta:   uploadMetaString,
+		Status:       allocation.UploadSessionOpen,
+	}
+	if err = session.Save(ctx); err != nil {
+		Logger.Error("Error in writing the upload session", zap.Error(err))
+		return nil, common.NewError("upload_session_write_error", "Error writing the upload session")
+	}
+	return session, nil
+}
+
+// getOpenUploadSession returns the open session passed in the request, read
+// with the mutex of its connection locked. The mutex is returned locked
+// unless an error is returned.
+func (fsh *StorageHandler) getOpenUploadSession(ctx context.Context, r *http.Request) (
+	*allocation.Allocation, *allocation.UploadSession, *sync.Mutex, error) {
+
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, nil, nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+
+	if len(clientID) == 0 {
+		return nil, nil, nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner or the payer of the allocation")
+	}
+
+	if err = r.ParseMultipartForm(FORM_FILE_PARSE_MAX_MEMORY); nil != err {
+		Logger.Info("Error Parsing the request", zap.Any("error", err))
+		return nil, nil, nil, common.NewError("request_parse_error", err.Error())
+	}
+
+	sessionID := r.FormValue("session_id")
+	session, err := allocation.GetUploadSession(ctx, sessionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, nil, nil, common.NewError("invalid_upload_session", "Upload session not found")
+	}
+
+	// read again once locked, the session may have moved on meanwhile
+	mutex := lock.GetMutex(allocation.AllocationChangeCollector{}.TableName(), session.ConnectionID)
+	mutex.Lock()
+	session, err = allocation.GetUploadSession(ctx, sessionID, allocationObj.ID, clientID)
+	if err != nil {
+		mutex.Unlock()
+		return nil, nil, nil, common.NewError("invalid_upload_session", "Upload session not found")
+	}
+	if session.Status != allocation.UploadSessionOpen {
+		mutex.Unlock()
+		return nil, nil, nil, common.NewError("invalid_upload_session", "Upload session is already finalized")
+	}
+	return allocationObj, session, mutex, nil
+}
+
+// WriteFileChunk stores a chunk of the file of an upload session. Chunks are
+// written in order, the offset of a chunk can't be past the size uploaded so
+// far, which the session reports to resume an interrupted upload. A chunk
+// written at a lower offset discards everything uploaded after it.
+func (fsh *StorageHandler) WriteFileChunk(ctx context.Context, r *http.Request) (*allocation.UploadSession, error) {
+	if r.Method != "POST" {
+		return nil, common.NewError("invalid_method", "Invalid method used for the upload chunk URL. Use multi-part form POST instead")
+	}
+
+	allocationObj, session, mutex, err := fsh.getOpenUploadSession(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer mutex.Unlock()
+
+	offset, err := strconv.ParseInt(r.FormValue("offset"), 10, 64)
+	if err != nil || offset < 0 || offset > session.UploadedSize {
+		return nil, common.NewErrorf("invalid_chunk_offset",
+			"Invalid chunk offset, expected offset up to %d", session.UploadedSize)
+	}
+
+	chunkHash := r.FormValue("chunk_hash")
+	if len(chunkHash) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid chunk hash passed")
+	}
+
+	chunkFile, chunkHeader, err := r.FormFile("uploadChunk")
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Error Reading multi parts for chunk."+err.Error())
+	}
+	defer chunkFile.Close()
+
+	if offset+chunkHeader.Size > config.Configuration.MaxFileSize {
+		return nil, common.NewError("file_size_limit_exceeded", "Size for the given file is larger than the max limit")
+	}
+
+	fileInputData := &filestore.FileInputData{Name: session.Filename, Path: session.Path}
+	written, writtenHash, err := filestore.GetFileStore().WriteFileChunk(allocationObj.ID, fileInputData,
+		chunkFile, offset, session.ConnectionID)
+	if err != nil {
+		return nil, common.NewError("upload_error", "Failed to upload the chunk. "+err.Error())
+	}
+
+	// a corrupted chunk is overwritten by the next attempt at the same offset
+	if writtenHash != chunkHash {
+		return nil, common.NewError("chunk_hash_mismatch", "Chunk hash does not match the chunk content")
+	}
+
+	session.UploadedSize = offset + written
+	if err = session.Save(ctx); err != nil {
+		Logger.Error("Error in writing the upload session", zap.Error(err))
+		return nil, common.NewError("upload_session_write_error", "Error writing the upload session")
+	}
+	return session, nil
+}
+
+// FinalizeUploadSession verifies the file uploaded in chunks the same way
+// WriteFile verifies a file uploaded at once and adds the insert or update
+// change of the session to its connection.
+func (fsh *StorageHandler) FinalizeUploadSession(ctx context.Context, r *http.Request) (*UploadResult, error) {
+	if r.Method != "POST" {
+		return nil, common.NewError("invalid_method", "Invalid method used for the finalize URL. Use multi-part form POST instead")
+	}
+
+	allocationObj, session, mutex, err := fsh.getOpenUploadSession(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer mutex.Unlock()
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, session.ConnectionID, allocationObj.ID, session.ClientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	var formData allocation.UpdateFileChange
+	if err = json.Unmarshal([]byte(session.UploadMeta), &formData); err != nil {
+		return nil, common.NewError("invalid_parameters",
+			"Invalid parameters. Error parsing the meta data for upload."+err.Error())
+	}
+
+	exisitingFileRef, err := fsh.checkUploadAccess(ctx, allocationObj, session.ClientID, session.Operation, formData.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInputData := &filestore.FileInputData{Name: session.Filename, Path: session.Path}
+	fileOutputData, err := filestore.GetFileStore().FinalizeFileChunks(allocationObj.ID, fileInputData,
+		session.UploadedSize, session.ConnectionID)
+	if err != nil {
+		return nil, common.NewError("upload_error", "Failed to finalize the file. "+err.Error())
+	}
+
+	result, err := fsh.addUploadChange(r, allocationObj, connectionObj, session.Operation, &formData,
+		exisitingFileRef, fileOutputData)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Status = allocation.UploadSessionFinalized
+	if err = session.Save(ctx); err != nil {
+		Logger.Error("Error in writing the upload session", zap.Error(err))
+		return nil, common.NewError("upload_session_write_error", "Error writing the upload session")
+	}
+
+	if err = connectionObj.Save(ctx); err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+	return result, nil
+}
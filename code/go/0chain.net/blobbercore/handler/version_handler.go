@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+// FileVersionsResult lists the versions kept for a file, latest first.
+// KeepVersions is the number of versions kept for the file on updates.
+type FileVersionsResult struct {
+	Path         string                   `json:"path"`
+	KeepVersions int                      `json:"keep_versions"`
+	Versions     []*reference.FileVersion `json:"versions"`
+}
+
+type RestoreVersionResult struct {
+	Path    string `json:"path"`
+	Version int64  `json:"version"`
+	Size    int64  `json:"size"`
+}
+
+// getVersionedFile returns the file at the path or path hash passed.
+func getVersionedFile(ctx context.Context, r *http.Request, allocationID string) (*reference.Ref, error) {
+	pathHash := r.FormValue("path_hash")
+	path := r.FormValue("path")
+	if len(pathHash) == 0 {
+		if len(path) == 0 {
+			return nil, common.NewError("invalid_parameters", "Invalid path")
+		}
+		pathHash = reference.GetReferenceLookup(allocationID, path)
+	}
+	fileRef, err := reference.GetReferenceFromLookupHash(ctx, allocationID, pathHash)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid file path. "+err.Error())
+	}
+	if fileRef.Type != reference.FILE {
+		return nil, common.NewError("invalid_parameters", "Path is not a file.")
+	}
+	return fileRef, nil
+}
+
+// ListFileVersions lists the versions kept for a file, for the owner, the
+// payer or a collaborator.
+func (fsh *StorageHandler) ListFileVersions(ctx context.Context, r *http.Request) (*FileVersionsResult, error) {
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, true)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 {
+		return nil, common.NewError("invalid_operation", "Invalid client")
+	}
+
+	fileRef, err := getVersionedFile(ctx, r, allocationObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	if allocationObj.OwnerID != clientID && allocationObj.PayerID != clientID &&
+		!reference.IsACollaborator(ctx, fileRef.ID, clientID) {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner, the payer or a collaborator")
+	}
+
+	rootRef, err := reference.GetReferencePath(ctx, allocationObj.ID, fileRef.Path)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid file path. "+err.Error())
+	}
+	versions, err := reference.GetFileVersions(ctx, fileRef.ID)
+	if err != nil {
+		return nil, common.NewError("file_version_error", "Error reading the file versions. "+err.Error())
+	}
+	return &FileVersionsResult{
+		Path:         fileRef.Path,
+		KeepVersions: reference.GetKeepVersions(rootRef, fileRef.Path),
+		Versions:     versions,
+	}, nil
+}
+
+// RestoreVersion adds the restore of a version kept for a file to a
+// connection.
+func (fsh *StorageHandler) RestoreVersion(ctx context.Context, r *http.Request) (*RestoreVersionResult, error) {
+	if r.Method != http.MethodPost {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	version, err := strconv.ParseInt(r.FormValue("version"), 10, 64)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid version")
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	fileRef, err := getVersionedFile(ctx, r, allocationObj.ID)
+	if err != nil {
+		return nil, err
+	}
+	fileVersion, err := reference.GetFileVersion(ctx, fileRef.ID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	allocationChange := &allocation.AllocationChange{}
+	allocationChange.ConnectionID = connectionObj.ConnectionID
+	allocationChange.Operation = allocation.RESTORE_VERSION_OPERATION
+	allocationChange.Size = fileVersion.Size - fileRef.Size
+	connectionObj.Size += allocationChange.Size
+	connectionObj.AddChange(allocationChange, &allocation.RestoreVersionChange{
+		ConnectionID: connectionObj.ConnectionID,
+		AllocationID: connectionObj.AllocationID,
+		Path:         fileRef.Path,
+		Version:      version,
+	})
+
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	return &RestoreVersionResult{Path: fileRef.Path, Version: version, Size: allocationChange.Size}, nil
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -19,11 +20,25 @@ import (
 	"go.uber.org/zap"
 )
 
+// TRASH_PURGE_BATCH_SIZE is the number of expired trash entries purged at
+// each run of the worker.
+const TRASH_PURGE_BATCH_SIZE = 1000
+
 func SetupWorkers(ctx context.Context) {
 	go CleanupTempFiles(ctx)
-	if config.Configuration.MinioStart {
+	go allocation.CommitJournalWorker(ctx)
+	if config.ColdStorageEnabled() {
 		go MoveColdDataToCloud(ctx)
 	}
+	if config.Configuration.ScrubEnabled {
+		go ScrubObjects(ctx)
+	}
+	if config.Configuration.TrashRetentionPeriod > 0 {
+		go PurgeTrash(ctx)
+	}
+	if config.Configuration.ExpiryWorkerFreq > 0 {
+		go allocation.ExpiryWorker(ctx)
+	}
 }
 
 func CleanupDiskFiles(ctx context.Context) error {
@@ -33,18 +48,16 @@ func CleanupDiskFiles(ctx context.Context) error {
 	for _, allocationObj := range allocations {
 		mutex := lock.GetMutex(allocationObj.TableName(), allocationObj.ID)
 		mutex.Lock()
-		filestore.GetFileStore().IterateObjects(allocationObj.ID, func(contentHash string, contentSize int64) {
-			var refs []reference.Ref
-			err := db.Table((reference.Ref{}).TableName()).Where(reference.Ref{ContentHash: contentHash, Type: reference.FILE}).Or(reference.Ref{ThumbnailHash: contentHash, Type: reference.FILE}).Find(&refs).Error
+		filestore.GetFileStore().IterateObjects(allocationObj.ID, func(object *filestore.ObjectInfo) {
+			count, err := reference.CountContentReferences(ctx, allocationObj.ID, object.Hash)
 			if err != nil {
 				Logger.Error("Error in cleanup of disk files.", zap.Error(err))
 				return
 			}
-			if len(refs) == 0 {
-				Logger.Info("hash has no references. Deleting from disk", zap.Any("count", len(refs)), zap.String("hash", contentHash))
-				filestore.GetFileStore().DeleteFile(allocationObj.ID, contentHash)
+			if count == 0 {
+				Logger.Info("hash has no references. Deleting from disk", zap.String("hash", object.Hash))
+				allocation.ReleaseContent(ctx, allocationObj.ID, object.Hash)
 			}
-			return
 		})
 		mutex.Unlock()
 	}
@@ -73,10 +86,7 @@ func CleanupTempFiles(ctx context.Context) {
 					connection.ComputeProperties()
 					nctx := datastore.GetStore().CreateTransaction(ctx)
 					ndb := datastore.GetStore().GetTransaction(nctx)
-					for _, changeProcessor := range connection.AllocationChanges {
-						changeProcessor.DeleteTempFile()
-					}
-					ndb.Model(connection).Updates(allocation.AllocationChangeCollector{Status: allocation.DeletedConnection})
+					deleteConnection(nctx, &connection)
 					ndb.Commit()
 					nctx.Done()
 				}
@@ -88,10 +98,35 @@ func CleanupTempFiles(ctx context.Context) {
 	}
 }
 
+// deleteConnection deletes the temp files of the changes and of the upload
+// sessions of the connection and marks it deleted.
+func deleteConnection(ctx context.Context, connection *allocation.AllocationChangeCollector) error {
+	for _, changeProcessor := range connection.AllocationChanges {
+		changeProcessor.DeleteTempFile()
+	}
+	deleteUploadSessions(ctx, connection.ConnectionID)
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Model(connection).Updates(allocation.AllocationChangeCollector{Status: allocation.DeletedConnection}).Error
+}
+
+// deleteUploadSessions removes temporary files of upload sessions of the
+// connection that have never been finalized.
+func deleteUploadSessions(ctx context.Context, connectionID string) {
+	sessions, err := allocation.GetOpenUploadSessions(ctx, connectionID)
+	if err != nil {
+		Logger.Error("Unable to get upload sessions of the connection", zap.Any("connection", connectionID), zap.Error(err))
+		return
+	}
+	db := datastore.GetStore().GetTransaction(ctx)
+	for _, session := range sessions {
+		fileData := &filestore.FileInputData{Name: session.Filename, Path: session.Path}
+		filestore.GetFileStore().DeleteTempFile(session.AllocationID, fileData, connectionID)
+		db.Model(session).Updates(allocation.UploadSession{Status: allocation.UploadSessionDeleted})
+	}
+}
+
 func MoveColdDataToCloud(ctx context.Context) {
 	var iterInprogress = false
-	var coldStorageMinFileSize = config.Configuration.ColdStorageMinimumFileSize
-	var limit = config.Configuration.ColdStorageJobQueryLimit
 	ticker := time.NewTicker(time.Duration(config.Configuration.MinioWorkerFreq) * time.Second)
 	for true {
 		select {
@@ -100,54 +135,10 @@ func MoveColdDataToCloud(ctx context.Context) {
 		case <-ticker.C:
 			if !iterInprogress {
 				iterInprogress = true
-				fs := filestore.GetFileStore()
-				totalDiskSizeUsed, err := fs.GetTotalDiskSizeUsed()
-				if err != nil {
-					Logger.Error("Unable to get total disk size used from the file store", zap.Error(err))
-					return
-				}
-
-				// Check if capacity exceded the start capacity size
-				if totalDiskSizeUsed > config.Configuration.ColdStorageStartCapacitySize {
-					rctx := datastore.GetStore().CreateTransaction(ctx)
-					db := datastore.GetStore().GetTransaction(rctx)
-					// Get total number of fileRefs with size greater than limit and on_cloud = false
-					var totalRecords int64
-					db.Table((&reference.Ref{}).TableName()).
-						Where("size > ? AND on_cloud = ?", coldStorageMinFileSize, false).
-						Count(&totalRecords)
-
-					offset := int64(0)
-					for offset < totalRecords {
-						// Get all fileRefs with size greater than limit and on_cloud false
-						var fileRefs []*reference.Ref
-						db.Offset(int(offset)).Limit(int(limit)).
-							Table((&reference.Ref{}).TableName()).
-							Where("size > ? AND on_cloud = ?", coldStorageMinFileSize, false).
-							Find(&fileRefs)
-
-						for _, fileRef := range fileRefs {
-							if fileRef.Type == reference.DIRECTORY {
-								continue
-							}
-
-							fileStat, err := stats.GetFileStats(rctx, fileRef.ID)
-							if err != nil {
-								Logger.Error("Unable to find filestats for fileRef with", zap.Any("reID", fileRef.ID))
-								continue
-							}
-
-							timeToAdd := time.Duration(config.Configuration.ColdStorageTimeLimitInHours) * time.Hour
-							if fileStat.UpdatedAt.Before(time.Now().Add(-1 * timeToAdd)) {
-								Logger.Info("Moving file to cloud", zap.Any("path", fileRef.Path), zap.Any("allocation", fileRef.AllocationID))
-								moveFileToCloud(ctx, fileRef)
-							}
-						}
-						offset = offset + limit
-					}
-					db.Commit()
-					rctx.Done()
+				if config.Configuration.ColdStoragePromoteAfterReads > 0 {
+					promoteColdData(ctx)
 				}
+				moveColdData(ctx)
 				iterInprogress = false
 				stats.LastMinioScan = time.Now()
 				Logger.Info("Move cold data to cloud worker running successfully")
@@ -156,6 +147,124 @@ func MoveColdDataToCloud(ctx context.Context) {
 	}
 }
 
+// coldFileRef is a file ref with the time the file was last read, or
+// written if never read.
+type coldFileRef struct {
+	reference.Ref
+	LastAccessedAt time.Time `gorm:"column:last_accessed_at"`
+}
+
+// moveColdData moves the least recently accessed files, not accessed within
+// the time limit, to the cloud until the disk usage drops below the start
+// capacity size.
+func moveColdData(ctx context.Context) {
+	fs := filestore.GetFileStore()
+	totalDiskSizeUsed, err := fs.GetTotalDiskSizeUsed()
+	if err != nil {
+		Logger.Error("Unable to get total disk size used from the file store", zap.Error(err))
+		return
+	}
+
+	var (
+		lastAccessedAt = time.Time{}
+		lastID         = int64(0)
+		timeToAdd      = time.Duration(config.Configuration.ColdStorageTimeLimitInHours) * time.Hour
+		accessedBefore = time.Now().Add(-1 * timeToAdd)
+	)
+	// Check if capacity exceded the start capacity size
+	for totalDiskSizeUsed > config.Configuration.ColdStorageStartCapacitySize {
+		rctx := datastore.GetStore().CreateTransaction(ctx)
+		db := datastore.GetStore().GetTransaction(rctx)
+		var fileRefs []*coldFileRef
+		err = db.Model(&reference.Ref{}).
+			Select("reference_objects.*, COALESCE(file_stats.last_accessed_at, reference_objects.updated_at) AS last_accessed_at").
+			Joins("LEFT JOIN file_stats ON file_stats.ref_id = reference_objects.id").
+			Where("reference_objects.type = ? AND reference_objects.size > ? AND reference_objects.on_cloud = ?",
+				reference.FILE, config.Configuration.ColdStorageMinimumFileSize, false).
+			Where("COALESCE(file_stats.last_accessed_at, reference_objects.updated_at) < ?", accessedBefore).
+			Where("(COALESCE(file_stats.last_accessed_at, reference_objects.updated_at), reference_objects.id) > (?, ?)",
+				lastAccessedAt, lastID).
+			Order("last_accessed_at, reference_objects.id").
+			Limit(int(config.Configuration.ColdStorageJobQueryLimit)).
+			Find(&fileRefs).Error
+		db.Rollback()
+		rctx.Done()
+		if err != nil {
+			Logger.Error("Unable to get cold files", zap.Error(err))
+			return
+		}
+		if len(fileRefs) == 0 {
+			return
+		}
+
+		for _, fileRef := range fileRefs {
+			Logger.Info("Moving file to cloud", zap.Any("path", fileRef.Path), zap.Any("allocation", fileRef.AllocationID))
+			moveFileToCloud(ctx, &fileRef.Ref)
+			lastAccessedAt, lastID = fileRef.LastAccessedAt, fileRef.ID
+		}
+
+		if totalDiskSizeUsed, err = fs.GetTotalDiskSizeUsed(); err != nil {
+			Logger.Error("Unable to get total disk size used from the file store", zap.Error(err))
+			return
+		}
+	}
+}
+
+// promoteColdData brings the files read from the cloud at least the
+// configured number of times back to the local disk.
+func promoteColdData(ctx context.Context) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	var fileRefs []*reference.Ref
+	err := db.Model(&reference.Ref{}).
+		Select("reference_objects.*").
+		Joins("JOIN file_stats ON file_stats.ref_id = reference_objects.id").
+		Where("reference_objects.type = ? AND reference_objects.on_cloud = ? AND file_stats.num_of_cold_reads >= ?",
+			reference.FILE, true, config.Configuration.ColdStoragePromoteAfterReads).
+		Limit(int(config.Configuration.ColdStorageJobQueryLimit)).
+		Find(&fileRefs).Error
+	db.Rollback()
+	rctx.Done()
+	if err != nil {
+		Logger.Error("Unable to get files to promote from cloud", zap.Error(err))
+		return
+	}
+
+	for _, fileRef := range fileRefs {
+		promoteFileFromCloud(ctx, fileRef)
+	}
+}
+
+func promoteFileFromCloud(ctx context.Context, fileRef *reference.Ref) {
+	err := filestore.GetFileStore().PromoteFromCloud(fileRef.AllocationID, fileRef.ContentHash)
+	if err != nil {
+		Logger.Error("Error promoting file from cloud", zap.Error(err), zap.Any("file_name", fileRef.Name), zap.Any("allocation", fileRef.AllocationID))
+		return
+	}
+
+	// the cloud copy is kept, the file can be moved back without uploading
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(ctx)
+	err = db.Model(&reference.Ref{}).
+		Where("id = ? AND content_hash = ?", fileRef.ID, fileRef.ContentHash).
+		Update("on_cloud", false).Error
+	if err == nil {
+		err = db.Model(&stats.FileStats{}).
+			Where(stats.FileStats{RefID: fileRef.ID}).
+			Update("num_of_cold_reads", 0).Error
+	}
+	if err != nil {
+		Logger.Error("Failed to update reference_object for on cloud false", zap.Error(err))
+		db.Rollback()
+		ctx.Done()
+		return
+	}
+
+	db.Commit()
+	ctx.Done()
+	Logger.Info("Successfully promoted file from cloud", zap.Any("file_name", fileRef.Name), zap.Any("allocation", fileRef.AllocationID))
+}
+
 func moveFileToCloud(ctx context.Context, fileRef *reference.Ref) {
 	fs := filestore.GetFileStore()
 	allocation, err := fs.SetupAllocation(fileRef.AllocationID, true)
@@ -168,7 +277,7 @@ func moveFileToCloud(ctx context.Context, fileRef *reference.Ref) {
 	fileObjectPath := filepath.Join(allocation.ObjectsPath, dirPath)
 	fileObjectPath = filepath.Join(fileObjectPath, destFile)
 
-	err = fs.UploadToCloud(fileRef.ContentHash, fileObjectPath)
+	err = fs.UploadToCloud(fileRef.AllocationID, fileRef.ContentHash, fileObjectPath)
 	if err != nil {
 		Logger.Error("Error uploading cold data to cloud", zap.Error(err), zap.Any("file_name", fileRef.Name), zap.Any("file_path", fileObjectPath))
 		return
@@ -190,7 +299,7 @@ func moveFileToCloud(ctx context.Context, fileRef *reference.Ref) {
 	Logger.Info("Successfully uploaded file to cloud", zap.Any("file_name", fileRef.Name), zap.Any("allocation", fileRef.AllocationID))
 
 	if config.Configuration.ColdStorageDeleteLocalCopy {
-		err = os.Remove(fileObjectPath)
+		err = fs.ReleaseObject(fileRef.AllocationID, fileRef.ContentHash)
 		if err != nil {
 			Logger.Error("Error deleting file after upload to cold storage", zap.Error(err))
 			return
@@ -198,3 +307,249 @@ func moveFileToCloud(ctx context.Context, fileRef *reference.Ref) {
 		Logger.Info("Successfully deleted file's local copy", zap.Any("file_name", fileRef.Name), zap.Any("allocation", fileRef.AllocationID))
 	}
 }
+
+// PurgeTrash periodically deletes the trash entries expired for good.
+func PurgeTrash(ctx context.Context) {
+	var iterInprogress = false
+	ticker := time.NewTicker(time.Duration(config.Configuration.TrashWorkerFreq) * time.Second)
+	for true {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !iterInprogress {
+				iterInprogress = true
+				purgeExpiredTrash(ctx)
+				iterInprogress = false
+				Logger.Info("Trash purge worker running successfully")
+			}
+		}
+	}
+}
+
+func purgeExpiredTrash(ctx context.Context) {
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	entries, err := reference.GetExpiredTrashEntries(rctx, time.Now(), TRASH_PURGE_BATCH_SIZE)
+	db.Rollback()
+	rctx.Done()
+	if err != nil {
+		Logger.Error("Unable to get the expired trash entries", zap.Error(err))
+		return
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		mutex := lock.GetMutex(allocation.Allocation{}.TableName(), entry.AllocationID)
+		mutex.Lock()
+		err = allocation.PurgeTrashEntries(ctx, entry.AllocationID, []*reference.TrashEntry{entry})
+		if err != nil {
+			Logger.Error("Unable to purge the trash entry", zap.Any("entry", entry.ID), zap.Error(err))
+		}
+		mutex.Unlock()
+	}
+}
+
+// ScrubObjects periodically verifies the objects of all allocations against
+// the content hash and the merkle root of the refs they are stored for.
+func ScrubObjects(ctx context.Context) {
+	var iterInprogress = false
+	ticker := time.NewTicker(time.Duration(config.Configuration.ScrubFreq) * time.Second)
+	for true {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !iterInprogress {
+				iterInprogress = true
+				rctx := datastore.GetStore().CreateTransaction(ctx)
+				db := datastore.GetStore().GetTransaction(rctx)
+				var allocations []allocation.Allocation
+				db.Find(&allocations)
+				db.Rollback()
+				rctx.Done()
+				for _, allocationObj := range allocations {
+					if ctx.Err() != nil {
+						return
+					}
+					scrubAllocation(ctx, allocationObj.ID)
+				}
+				iterInprogress = false
+				stats.SetLastScrub(time.Now())
+				Logger.Info("Scrub worker running successfully")
+			}
+		}
+	}
+}
+
+// scrubAllocation walks the objects of the allocation at the configured
+// rate and records the result for each file ref. Objects failing the check
+// are verified again under the allocation lock, so that files changed by a
+// commit in the meantime aren't reported. The results of the refs deleted
+// since their scrub are deleted at the end of the pass.
+func scrubAllocation(ctx context.Context, allocationID string) {
+	fs := filestore.GetFileStore()
+
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	var refs []*reference.Ref
+	err := db.Where(&reference.Ref{AllocationID: allocationID, Type: reference.FILE}).Find(&refs).Error
+	db.Rollback()
+	rctx.Done()
+	if err != nil {
+		Logger.Error("Unable to get file refs of the allocation", zap.Any("allocation", allocationID), zap.Error(err))
+		return
+	}
+
+	var (
+		byHash = make(map[string][]*reference.Ref)
+		failed = make(map[int64]bool)
+		seen   = make(map[string]bool)
+		rate   = config.Configuration.ScrubBytesPerSecond
+	)
+	for _, ref := range refs {
+		byHash[ref.ContentHash] = append(byHash[ref.ContentHash], ref)
+		if len(ref.ThumbnailHash) != 0 {
+			byHash[ref.ThumbnailHash] = append(byHash[ref.ThumbnailHash], ref)
+		}
+	}
+
+	err = fs.IterateObjects(allocationID, func(object *filestore.ObjectInfo) {
+		seen[object.Hash] = true
+		for _, ref := range byHash[object.Hash] {
+			if object.ContentHash != object.Hash ||
+				(object.Hash == ref.ContentHash && object.MerkleRoot != ref.MerkleRoot) {
+				failed[ref.ID] = true
+			}
+		}
+		if rate > 0 {
+			time.Sleep(time.Duration(float64(object.Size) / float64(rate) * float64(time.Second)))
+		}
+	})
+	if err != nil {
+		Logger.Error("Unable to scrub the allocation", zap.Any("allocation", allocationID), zap.Error(err))
+		return
+	}
+
+	for _, ref := range refs {
+		if !seen[ref.ContentHash] && !ref.OnCloud {
+			failed[ref.ID] = true
+		}
+		if len(ref.ThumbnailHash) != 0 && !seen[ref.ThumbnailHash] {
+			failed[ref.ID] = true
+		}
+	}
+
+	for _, ref := range refs {
+		result := &stats.ScrubResult{
+			RefID:          ref.ID,
+			AllocationID:   ref.AllocationID,
+			Path:           ref.Path,
+			ContentHash:    ref.ContentHash,
+			Status:         stats.ScrubStatusOK,
+			LastScrubbedAt: time.Now(),
+		}
+		if failed[ref.ID] {
+			if result = rescrubRef(ctx, ref); result == nil {
+				continue
+			}
+		}
+		if result.Status != stats.ScrubStatusOK {
+			Logger.Error("Scrub found a damaged file", zap.Any("allocation", ref.AllocationID),
+				zap.Any("path", ref.Path), zap.Any("status", result.Status), zap.Any("error", result.Error))
+		}
+		sctx := datastore.GetStore().CreateTransaction(ctx)
+		sdb := datastore.GetStore().GetTransaction(sctx)
+		if err := result.Save(sctx); err != nil {
+			Logger.Error("Unable to save the scrub result", zap.Any("ref", ref.ID), zap.Error(err))
+			sdb.Rollback()
+		} else {
+			sdb.Commit()
+		}
+		sctx.Done()
+	}
+
+	sctx := datastore.GetStore().CreateTransaction(ctx)
+	sdb := datastore.GetStore().GetTransaction(sctx)
+	if err := stats.DeleteStaleScrubResults(sctx, allocationID); err != nil {
+		Logger.Error("Unable to delete the stale scrub results", zap.Any("allocation", allocationID), zap.Error(err))
+		sdb.Rollback()
+	} else {
+		sdb.Commit()
+	}
+	sctx.Done()
+}
+
+// rescrubRef verifies the objects of the ref again, restoring its content
+// from the cloud if configured. It returns nil if the ref has been changed
+// or deleted since the scrub started.
+func rescrubRef(ctx context.Context, ref *reference.Ref) *stats.ScrubResult {
+	mutex := lock.GetMutex(allocation.Allocation{}.TableName(), ref.AllocationID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	rctx := datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(rctx)
+	current := &reference.Ref{}
+	err := db.Where("id = ?", ref.ID).First(current).Error
+	db.Rollback()
+	rctx.Done()
+	if err != nil || current.ContentHash != ref.ContentHash ||
+		current.ThumbnailHash != ref.ThumbnailHash {
+		return nil
+	}
+
+	fs := filestore.GetFileStore()
+	result := &stats.ScrubResult{
+		RefID:        current.ID,
+		AllocationID: current.AllocationID,
+		Path:         current.Path,
+		ContentHash:  current.ContentHash,
+	}
+	result.Status, result.Error = checkObject(fs, current.AllocationID,
+		current.ContentHash, current.MerkleRoot, current.OnCloud)
+	if result.Status != stats.ScrubStatusOK && current.OnCloud &&
+		config.Configuration.ScrubRestoreFromCloud && config.ColdStorageEnabled() {
+
+		if err = restoreObject(fs, current); err != nil {
+			Logger.Error("Unable to restore file from the cloud", zap.Any("path", current.Path), zap.Error(err))
+		} else if status, _ := checkObject(fs, current.AllocationID, current.ContentHash, current.MerkleRoot, false); status == stats.ScrubStatusOK {
+			Logger.Info("Restored file from the cloud", zap.Any("path", current.Path), zap.Any("allocation", current.AllocationID))
+			result.Status, result.Error = stats.ScrubStatusRestored, ""
+		}
+	}
+	if result.Status != stats.ScrubStatusCorrupt && result.Status != stats.ScrubStatusMissing &&
+		len(current.ThumbnailHash) != 0 {
+
+		if status, errMsg := checkObject(fs, current.AllocationID, current.ThumbnailHash, "", false); status != stats.ScrubStatusOK {
+			result.Status, result.Error = status, errMsg
+		}
+	}
+	result.LastScrubbedAt = time.Now()
+	return result
+}
+
+// checkObject returns the scrub status of the object stored under the hash.
+// A missing object is fine if the file is on the cloud.
+func checkObject(fs filestore.FileStore, allocationID, hash, merkleRoot string, onCloud bool) (string, string) {
+	object, err := fs.GetObjectInfo(allocationID, hash)
+	if os.IsNotExist(err) {
+		if onCloud {
+			return stats.ScrubStatusOK, ""
+		}
+		return stats.ScrubStatusMissing, fmt.Sprintf("object %s not found", hash)
+	}
+	if err != nil {
+		return stats.ScrubStatusCorrupt, err.Error()
+	}
+	if object.ContentHash != hash || (len(merkleRoot) != 0 && object.MerkleRoot != merkleRoot) {
+		return stats.ScrubStatusCorrupt, fmt.Sprintf("object %s doesn't match its hash", hash)
+	}
+	return stats.ScrubStatusOK, ""
+}
+
+func restoreObject(fs filestore.FileStore, fileRef *reference.Ref) error {
+	return fs.RestoreFromCloud(fileRef.AllocationID, fileRef.ContentHash)
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/blobbercore/writemarker"
+	"0chain.net/core/common"
+)
+
+var writeMarkerStatuses = map[writemarker.WriteMarkerStatus]string{
+	writemarker.Accepted:  "accepted",
+	writemarker.Committed: "committed",
+	writemarker.Failed:    "failed",
+}
+
+// WriteMarkerHistoryEntry is a write marker of the allocation with its
+// redeem status. The redeem transaction is the close connection transaction
+// sent to the miners.
+type WriteMarkerHistoryEntry struct {
+	Sequence      int64                   `json:"sequence"`
+	WriteMarker   writemarker.WriteMarker `json:"write_marker"`
+	ConnectionID  string                  `json:"connection_id"`
+	Status        string                  `json:"status"`
+	StatusMessage string                  `json:"status_message,omitempty"`
+	RedeemRetries int64                   `json:"redeem_retries"`
+	RedeemTxnID   string                  `json:"redeem_txn_id,omitempty"`
+	// History is true if the refs as of the write marker can be read
+	History   bool      `json:"history"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WriteMarkerHistoryResult struct {
+	WriteMarkers []*WriteMarkerHistoryEntry `json:"write_markers"`
+	NextCursor   string                     `json:"next_cursor,omitempty"`
+}
+
+type DiffResult struct {
+	FromAllocationRoot string               `json:"from_allocation_root"`
+	ToAllocationRoot   string               `json:"to_allocation_root"`
+	Diffs              []*reference.RefDiff `json:"diffs"`
+	NextCursor         string               `json:"next_cursor,omitempty"`
+}
+
+// getPageSize returns the page_size param, MAX_LIST_PAGE_SIZE by default.
+func getPageSize(r *http.Request) (int, error) {
+	pageSizeStr := r.FormValue("page_size")
+	if len(pageSizeStr) == 0 {
+		return MAX_LIST_PAGE_SIZE, nil
+	}
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil || pageSize <= 0 || pageSize > MAX_LIST_PAGE_SIZE {
+		return 0, common.NewErrorf("invalid_parameters", "Invalid page size, at most %d", MAX_LIST_PAGE_SIZE)
+	}
+	return pageSize, nil
+}
+
+func (fsh *StorageHandler) verifyOwnerReadOnly(ctx context.Context) (*allocation.Allocation, error) {
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, true)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+	return allocationObj, nil
+}
+
+// ListWriteMarkers lists the write markers of the allocation, latest first.
+// It's for the owner of the allocation only.
+func (fsh *StorageHandler) ListWriteMarkers(ctx context.Context, r *http.Request) (*WriteMarkerHistoryResult, error) {
+	allocationObj, err := fsh.verifyOwnerReadOnly(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pageSize, err := getPageSize(r)
+	if err != nil {
+		return nil, err
+	}
+	var cursor int64
+	if cursorStr := r.FormValue("cursor"); len(cursorStr) != 0 {
+		if cursor, err = strconv.ParseInt(cursorStr, 10, 64); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid cursor")
+		}
+	}
+
+	records, err := writemarker.GetWriteMarkers(ctx, allocationObj.ID, cursor, pageSize+1)
+	if err != nil {
+		return nil, common.NewError("write_marker_error", "Error reading the write markers. "+err.Error())
+	}
+	result := &WriteMarkerHistoryResult{}
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		result.NextCursor = strconv.FormatInt(records[pageSize-1].Sequence, 10)
+	}
+	result.WriteMarkers = make([]*WriteMarkerHistoryEntry, len(records))
+	for idx, record := range records {
+		result.WriteMarkers[idx] = &WriteMarkerHistoryEntry{
+			Sequence:      record.Sequence,
+			WriteMarker:   record.WM,
+			ConnectionID:  record.ConnectionID,
+			Status:        writeMarkerStatuses[record.Status],
+			StatusMessage: record.StatusMessage,
+			RedeemRetries: record.ReedeemRetries,
+			RedeemTxnID:   record.CloseTxnID,
+			History:       record.History,
+			CreatedAt:     record.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+// diffSequence returns the sequence of the write marker of the allocation
+// root, 0 for the empty root before the first write marker.
+func diffSequence(ctx context.Context, allocationID string, allocationRoot string) (int64, error) {
+	if len(allocationRoot) == 0 {
+		return 0, nil
+	}
+	sequence, err := writemarker.GetWriteMarkerSequence(ctx, allocationID, allocationRoot)
+	if err != nil {
+		return 0, common.NewError("invalid_parameters", "Invalid allocation root. "+err.Error())
+	}
+	return sequence, nil
+}
+
+// DiffAllocationRoots lists the paths added, modified and deleted from the
+// from allocation root to the to allocation root, the current one by
+// default. The from allocation root is empty for the allocation before its
+// first write marker. It's for the owner of the allocation only.
+func (fsh *StorageHandler) DiffAllocationRoots(ctx context.Context, r *http.Request) (*DiffResult, error) {
+	allocationObj, err := fsh.verifyOwnerReadOnly(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pageSize, err := getPageSize(r)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(r.FormValue("cursor"))
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid cursor")
+	}
+
+	result := &DiffResult{FromAllocationRoot: r.FormValue("from"), ToAllocationRoot: r.FormValue("to")}
+	fromSequence, err := diffSequence(ctx, allocationObj.ID, result.FromAllocationRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*reference.RefDiff
+	if len(r.Form["to"]) == 0 {
+		// the current refs, whether the history is kept or not
+		result.ToAllocationRoot = allocationObj.AllocationRoot
+		diffs, err = reference.DiffRefsToCurrent(ctx, allocationObj.ID, fromSequence, string(cursor), pageSize+1)
+	} else {
+		var toSequence int64
+		if toSequence, err = diffSequence(ctx, allocationObj.ID, result.ToAllocationRoot); err != nil {
+			return nil, err
+		}
+		diffs, err = reference.DiffRefsAtSequences(ctx, allocationObj.ID, fromSequence, toSequence, string(cursor), pageSize+1)
+	}
+	if err != nil {
+		return nil, common.NewError("diff_error", "Error comparing the allocation roots. "+err.Error())
+	}
+	result.Diffs, result.NextCursor = diffPage(diffs, pageSize)
+	return result, nil
+}
+
+// diffPage returns the page of the diffs read one beyond the page size,
+// with the cursor of the next page if there's one.
+func diffPage(diffs []*reference.RefDiff, pageSize int) ([]*reference.RefDiff, string) {
+	if len(diffs) <= pageSize {
+		return diffs, ""
+	}
+	diffs = diffs[:pageSize]
+	return diffs, base64.RawURLEncoding.EncodeToString([]byte(diffs[pageSize-1].Path))
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"0chain.net/blobbercore/reference"
+)
+
+func TestDiffPage(t *testing.T) {
+	diffs := []*reference.RefDiff{{Path: "/a"}, {Path: "/b"}, {Path: "/c"}}
+
+	page, cursor := diffPage(diffs, 2)
+	if len(page) != 2 || page[1].Path != "/b" {
+		t.Fatalf("unexpected page: %v", page)
+	}
+	// the next page starts after the last path of the page
+	if after, err := base64.RawURLEncoding.DecodeString(cursor); err != nil || string(after) != "/b" {
+		t.Errorf("unexpected cursor %q: %v", cursor, err)
+	}
+
+	// a full last page has no next page, the extra diff is read to tell
+	for _, n := range []int{0, 2, 3} {
+		if page, cursor = diffPage(diffs[:n], 3); len(page) != n || cursor != "" {
+			t.Errorf("%d diffs: %d in the page, cursor %q", n, len(page), cursor)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+
+	"0chain.net/blobbercore/allocation"
+	"0chain.net/blobbercore/constants"
+	"0chain.net/blobbercore/reference"
+	"0chain.net/core/common"
+	"0chain.net/core/lock"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
+)
+
+type UpdateXAttrsResult struct {
+	Path   string            `json:"path"`
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+// UpdateXAttrs adds the update of the xattrs of a file or a directory to a
+// connection. The set param is a JSON object of the keys set, the remove
+// param a JSON array of the keys removed.
+func (fsh *StorageHandler) UpdateXAttrs(ctx context.Context, r *http.Request) (*UpdateXAttrsResult, error) {
+	if r.Method != http.MethodPost {
+		return nil, common.NewError("invalid_method", "Invalid method used. Use POST instead")
+	}
+	allocationTx := ctx.Value(constants.ALLOCATION_CONTEXT_KEY).(string)
+	clientID := ctx.Value(constants.CLIENT_CONTEXT_KEY).(string)
+
+	allocationObj, err := fsh.verifyAllocation(ctx, allocationTx, false)
+	if err != nil {
+		return nil, common.NewError("invalid_parameters", "Invalid allocation id passed."+err.Error())
+	}
+	if len(clientID) == 0 || allocationObj.OwnerID != clientID {
+		return nil, common.NewError("invalid_operation", "Operation needs to be performed by the owner of the allocation")
+	}
+
+	var set map[string]string
+	if setStr := r.FormValue("set"); len(setStr) != 0 {
+		if err = json.Unmarshal([]byte(setStr), &set); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid xattrs to set. "+err.Error())
+		}
+	}
+	var remove []string
+	if removeStr := r.FormValue("remove"); len(removeStr) != 0 {
+		if err = json.Unmarshal([]byte(removeStr), &remove); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid xattrs to remove. "+err.Error())
+		}
+	}
+	if len(set) == 0 && len(remove) == 0 {
+		return nil, common.NewError("invalid_parameters", "No xattrs to set or remove")
+	}
+	if err = reference.ValidateXAttrs(set); err != nil {
+		return nil, err
+	}
+
+	path := r.FormValue("path")
+	if pathHash := r.FormValue("path_hash"); len(pathHash) != 0 {
+		ref, err := reference.GetReferenceFromLookupHash(ctx, allocationObj.ID, pathHash)
+		if err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid path. "+err.Error())
+		}
+		path = ref.Path
+	} else if len(path) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid path")
+	}
+	path = filepath.Clean(path)
+	if path != "/" {
+		if _, err = reference.GetReference(ctx, allocationObj.ID, path); err != nil {
+			return nil, common.NewError("invalid_parameters", "Invalid path. "+err.Error())
+		}
+	}
+
+	connectionID := r.FormValue("connection_id")
+	if len(connectionID) == 0 {
+		return nil, common.NewError("invalid_parameters", "Invalid connection id passed")
+	}
+
+	connectionObj, err := allocation.GetAllocationChanges(ctx, connectionID, allocationObj.ID, clientID)
+	if err != nil {
+		return nil, common.NewError("meta_error", "Error reading metadata for connection")
+	}
+
+	mutex := lock.GetMutex(connectionObj.TableName(), connectionID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	allocationChange := &allocation.AllocationChange{}
+	allocationChange.ConnectionID = connectionObj.ConnectionID
+	allocationChange.Operation = allocation.UPDATE_XATTRS_OPERATION
+	connectionObj.AddChange(allocationChange, &allocation.XAttrsChange{
+		ConnectionID: connectionObj.ConnectionID,
+		AllocationID: connectionObj.AllocationID,
+		Path:         path,
+		Set:          set,
+		Remove:       remove,
+	})
+
+	err = connectionObj.Save(ctx)
+	if err != nil {
+		Logger.Error("Error in writing the connection meta data", zap.Error(err))
+		return nil, common.NewError("connection_write_error", "Error writing the connection meta data")
+	}
+
+	return &UpdateXAttrsResult{Path: path, Set: set, Remove: remove}, nil
+}
@@ -0,0 +1,149 @@
+package reference
+
+import (
+	"context"
+	"fmt"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/common"
+)
+
+// The versions of the refs are kept in reference_objects_history, each valid
+// from the write marker committing it until the write marker superseding it,
+// in the order of the sequences of the write markers. The tree as of a write
+// marker is made of the versions valid at its sequence.
+const refsAtSequenceQuery = `SELECT * FROM (
+	SELECT (jsonb_populate_record(NULL::reference_objects, data)).* FROM reference_objects_history
+	WHERE allocation_id = ? AND valid_from_seq <= ? AND (valid_to_seq IS NULL OR valid_to_seq > ?) AND %s
+) AS refs WHERE deleted_at IS NULL`
+
+func getRefsAtSequence(ctx context.Context, allocationID string, sequence int64, where string, args ...interface{}) ([]*Ref, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var refs []*Ref
+	query := fmt.Sprintf(refsAtSequenceQuery, where) + " ORDER BY level, created_at"
+	err := db.Raw(query, append([]interface{}{allocationID, sequence, sequence}, args...)...).Scan(&refs).Error
+	return refs, err
+}
+
+// GetReferenceAtSequence returns the ref at the path as it was at the write
+// marker with the sequence.
+func GetReferenceAtSequence(ctx context.Context, allocationID string, path string, sequence int64) (*Ref, error) {
+	refs, err := getRefsAtSequence(ctx, allocationID, sequence, "path = ?", path)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, common.NewError("invalid_parameters", "Path not found at the allocation root")
+	}
+	return refs[0], nil
+}
+
+// GetReferenceFromLookupHashAtSequence returns the ref with the lookup hash
+// as it was at the write marker with the sequence.
+func GetReferenceFromLookupHashAtSequence(ctx context.Context, allocationID string, pathHash string, sequence int64) (*Ref, error) {
+	refs, err := getRefsAtSequence(ctx, allocationID, sequence, "lookup_hash = ?", pathHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, common.NewError("invalid_parameters", "Path not found at the allocation root")
+	}
+	return refs[0], nil
+}
+
+// GetRefWithChildrenAtSequence returns the directory at the path with its
+// children as they were at the write marker with the sequence.
+func GetRefWithChildrenAtSequence(ctx context.Context, allocationID string, path string, sequence int64) (*Ref, error) {
+	refs, err := getRefsAtSequence(ctx, allocationID, sequence, "(path = ? OR parent_path = ?)", path, path)
+	if err != nil {
+		return nil, err
+	}
+	return refWithChildren(allocationID, path, refs)
+}
+
+// refWithChildren returns the directory at the path with its children, from
+// the refs sorted by level.
+func refWithChildren(allocationID string, path string, refs []*Ref) (*Ref, error) {
+	if len(refs) == 0 {
+		return &Ref{Type: DIRECTORY, Path: path, AllocationID: allocationID}, nil
+	}
+	curRef := refs[0]
+	if curRef.Path != path {
+		return nil, common.NewError("invalid_dir_tree", "DB has invalid tree. Root not found in DB")
+	}
+	for i := 1; i < len(refs); i++ {
+		if refs[i].ParentPath == curRef.Path {
+			curRef.Children = append(curRef.Children, refs[i])
+		} else {
+			return nil, common.NewError("invalid_dir_tree", "DB has invalid tree.")
+		}
+	}
+	return curRef, nil
+}
+
+const (
+	DIFF_ADDED    = "added"
+	DIFF_MODIFIED = "modified"
+	DIFF_DELETED  = "deleted"
+)
+
+// RefDiff is a path added, modified or deleted between two write markers. A
+// directory is modified when its hash changes, as its content does.
+type RefDiff struct {
+	Path    string `gorm:"column:path" json:"path"`
+	Type    string `gorm:"column:type" json:"type"`
+	Change  string `gorm:"-" json:"change"`
+	OldHash string `gorm:"column:old_hash" json:"old_hash,omitempty"`
+	NewHash string `gorm:"column:new_hash" json:"new_hash,omitempty"`
+}
+
+const refsDiffQuery = `SELECT COALESCE(b.path, a.path) AS path, COALESCE(b.type, a.type) AS type,
+	COALESCE(a.hash, '') AS old_hash, COALESCE(b.hash, '') AS new_hash
+FROM (%s) AS a FULL OUTER JOIN (%s) AS b ON a.path = b.path
+WHERE a.hash IS DISTINCT FROM b.hash AND COALESCE(b.path, a.path) > ?
+ORDER BY 1 LIMIT ?`
+
+// DiffRefsAtSequences returns the paths added, modified or deleted from the
+// write marker with the first sequence to the one with the second, sorted by
+// path, at most limit of them after the path passed. The allocation has no
+// refs at the sequence 0.
+func DiffRefsAtSequences(ctx context.Context, allocationID string, fromSequence, toSequence int64, afterPath string, limit int) ([]*RefDiff, error) {
+	refsQuery := fmt.Sprintf(refsAtSequenceQuery, "TRUE")
+	return diffRefs(ctx, fmt.Sprintf(refsDiffQuery, refsQuery, refsQuery),
+		allocationID, fromSequence, fromSequence, allocationID, toSequence, toSequence, afterPath, limit)
+}
+
+// DiffRefsToCurrent returns the paths added, modified or deleted from the
+// write marker with the sequence to the current refs, the same as
+// DiffRefsAtSequences.
+func DiffRefsToCurrent(ctx context.Context, allocationID string, fromSequence int64, afterPath string, limit int) ([]*RefDiff, error) {
+	return diffRefs(ctx, fmt.Sprintf(refsDiffQuery, fmt.Sprintf(refsAtSequenceQuery, "TRUE"), currentRefsQuery),
+		allocationID, fromSequence, fromSequence, allocationID, afterPath, limit)
+}
+
+const currentRefsQuery = `SELECT * FROM reference_objects WHERE allocation_id = ? AND deleted_at IS NULL`
+
+func diffRefs(ctx context.Context, query string, args ...interface{}) ([]*RefDiff, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var diffs []*RefDiff
+	if err := db.Raw(query, args...).Scan(&diffs).Error; err != nil {
+		return nil, err
+	}
+	for _, diff := range diffs {
+		diff.Change = diffChange(diff)
+	}
+	return diffs, nil
+}
+
+// diffChange returns whether the path of the diff is added, modified or
+// deleted, from the hashes it has before and after.
+func diffChange(diff *RefDiff) string {
+	switch {
+	case len(diff.OldHash) == 0:
+		return DIFF_ADDED
+	case len(diff.NewHash) == 0:
+		return DIFF_DELETED
+	default:
+		return DIFF_MODIFIED
+	}
+}
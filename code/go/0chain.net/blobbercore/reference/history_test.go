@@ -0,0 +1,44 @@
+package reference
+
+import "testing"
+
+func TestRefWithChildren(t *testing.T) {
+	ref, err := refWithChildren("alloc", "/dir", nil)
+	if err != nil || ref.Type != DIRECTORY || ref.Path != "/dir" || len(ref.Children) != 0 {
+		t.Fatalf("missing dir: %+v, %v", ref, err)
+	}
+
+	if _, err = refWithChildren("alloc", "/dir", []*Ref{{Path: "/other"}}); err == nil {
+		t.Fatal("expected an error for a wrong root")
+	}
+
+	refs := []*Ref{{Path: "/dir", Type: DIRECTORY}, {Path: "/dir/a", ParentPath: "/dir"}, {Path: "/x/b", ParentPath: "/x"}}
+	if _, err = refWithChildren("alloc", "/dir", refs); err == nil {
+		t.Fatal("expected an error for a child of another parent")
+	}
+
+	refs = []*Ref{{Path: "/dir", Type: DIRECTORY}, {Path: "/dir/a", ParentPath: "/dir"}, {Path: "/dir/b", ParentPath: "/dir"}}
+	ref, err = refWithChildren("alloc", "/dir", refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != refs[0] || len(ref.Children) != 2 || ref.Children[0] != refs[1] || ref.Children[1] != refs[2] {
+		t.Fatalf("unexpected children: %+v", ref.Children)
+	}
+}
+
+func TestDiffChange(t *testing.T) {
+	tests := []struct {
+		diff   RefDiff
+		change string
+	}{
+		{RefDiff{NewHash: "new"}, DIFF_ADDED},
+		{RefDiff{OldHash: "old"}, DIFF_DELETED},
+		{RefDiff{OldHash: "old", NewHash: "new"}, DIFF_MODIFIED},
+	}
+	for _, tt := range tests {
+		if change := diffChange(&tt.diff); change != tt.change {
+			t.Errorf("%+v: %s, expected %s", tt.diff, change, tt.change)
+		}
+	}
+}
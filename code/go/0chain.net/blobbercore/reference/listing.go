@@ -0,0 +1,144 @@
+package reference
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/common"
+)
+
+// Sort orders of listings
+const (
+	SortByName      = "name"
+	SortBySize      = "size"
+	SortByUpdatedAt = "updated_at"
+)
+
+// ListingOptions selects a page of the children of a directory. The page
+// starts after the cursor of the last child of the previous page.
+type ListingOptions struct {
+	PageSize int
+	SortBy   string
+	Desc     bool
+	Cursor   string
+	Type     string // FILE or DIRECTORY, all children if empty
+	MimeType string // exact mimetype, or a prefix as "image/*"
+}
+
+// timestamps of cursors are compared as the timestamps of the database
+const cursorTimeFormat = "2006-01-02 15:04:05.999999"
+
+// listingCursor is the position of a child in a listing, its sort value and
+// its id to break ties.
+type listingCursor struct {
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+func (opts *ListingOptions) sortValue(ref *Ref) string {
+	switch opts.SortBy {
+	case SortBySize:
+		return strconv.FormatInt(ref.Size, 10)
+	case SortByUpdatedAt:
+		return ref.UpdatedAt.Format(cursorTimeFormat)
+	}
+	return ref.Name
+}
+
+// decodeCursor returns the sort value of the cursor, with the placeholder
+// casting it to the type of the column, and its id.
+func (opts *ListingOptions) decodeCursor() (string, string, int64, error) {
+	errCursor := common.NewError("invalid_parameters", "Invalid cursor")
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return "", "", 0, errCursor
+	}
+	var cursor listingCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return "", "", 0, errCursor
+	}
+	placeholder := "?"
+	switch opts.SortBy {
+	case SortBySize:
+		_, err = strconv.ParseInt(cursor.Value, 10, 64)
+		placeholder = "?::bigint"
+	case SortByUpdatedAt:
+		_, err = time.Parse(cursorTimeFormat, cursor.Value)
+		placeholder = "?::timestamp"
+	}
+	if err != nil {
+		return "", "", 0, errCursor
+	}
+	return cursor.Value, placeholder, cursor.ID, nil
+}
+
+func (opts *ListingOptions) encodeCursor(ref *Ref) string {
+	data, _ := json.Marshal(&listingCursor{Value: opts.sortValue(ref), ID: ref.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Validate checks the options, defaulting the sort order to the name.
+func (opts *ListingOptions) Validate() error {
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = SortByName
+	case SortByName, SortBySize, SortByUpdatedAt:
+	default:
+		return common.NewError("invalid_parameters", "Invalid sort order. Use name, size or updated_at")
+	}
+	if opts.Type != "" && opts.Type != FILE && opts.Type != DIRECTORY {
+		return common.NewError("invalid_parameters", "Invalid type filter")
+	}
+	if opts.PageSize <= 0 {
+		return common.NewError("invalid_parameters", "Invalid page size")
+	}
+	if len(opts.Cursor) != 0 {
+		if _, _, _, err := opts.decodeCursor(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetChildrenPage returns a page of the children of the directory, and the
+// cursor of the next page, empty on the last page.
+func GetChildrenPage(ctx context.Context, allocationID string, path string, opts *ListingOptions) ([]*Ref, string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", err
+	}
+	db := datastore.GetStore().GetTransaction(ctx)
+	query := db.Model(&Ref{}).Where("allocation_id = ? AND parent_path = ?", allocationID, path)
+	if len(opts.Type) != 0 {
+		query = query.Where("type = ?", opts.Type)
+	}
+	if strings.HasSuffix(opts.MimeType, "/*") {
+		query = query.Where("mimetype LIKE ?", strings.TrimSuffix(opts.MimeType, "*")+"%")
+	} else if len(opts.MimeType) != 0 {
+		query = query.Where("mimetype = ?", opts.MimeType)
+	}
+
+	order, cmp := "ASC", ">"
+	if opts.Desc {
+		order, cmp = "DESC", "<"
+	}
+	if len(opts.Cursor) != 0 {
+		value, placeholder, id, _ := opts.decodeCursor()
+		query = query.Where("("+opts.SortBy+", id) "+cmp+" ("+placeholder+", ?)", value, id)
+	}
+
+	var refs []*Ref
+	err := query.Order(opts.SortBy + " " + order + ", id " + order).Limit(opts.PageSize + 1).Find(&refs).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(refs) <= opts.PageSize {
+		return refs, "", nil
+	}
+	refs = refs[:opts.PageSize]
+	return refs, opts.encodeCursor(refs[len(refs)-1]), nil
+}
@@ -0,0 +1,51 @@
+package reference
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListingCursor(t *testing.T) {
+	ref := &Ref{ID: 42, Name: "file, \"quoted\"", Size: 1 << 40}
+	ref.UpdatedAt = time.Date(2021, 3, 4, 5, 6, 7, 123456000, time.UTC)
+
+	tests := []struct {
+		sortBy      string
+		value       string
+		placeholder string
+	}{
+		{SortByName, ref.Name, "?"},
+		{SortBySize, "1099511627776", "?::bigint"},
+		{SortByUpdatedAt, "2021-03-04 05:06:07.123456", "?::timestamp"},
+	}
+	for _, tt := range tests {
+		opts := &ListingOptions{PageSize: 10, SortBy: tt.sortBy}
+		opts.Cursor = opts.encodeCursor(ref)
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("%s: %v", tt.sortBy, err)
+		}
+		value, placeholder, id, err := opts.decodeCursor()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sortBy, err)
+		}
+		if value != tt.value || placeholder != tt.placeholder || id != ref.ID {
+			t.Errorf("%s: got cursor %q %s %d, want %q %s %d", tt.sortBy,
+				value, placeholder, id, tt.value, tt.placeholder, ref.ID)
+		}
+	}
+
+	// cursors of another sort order, or not cursors at all, are rejected
+	nameCursor := (&ListingOptions{SortBy: SortByName}).encodeCursor(ref)
+	for _, opts := range []*ListingOptions{
+		{PageSize: 10, SortBy: SortBySize, Cursor: nameCursor},
+		{PageSize: 10, SortBy: SortByUpdatedAt, Cursor: nameCursor},
+		{PageSize: 10, Cursor: "not a cursor"},
+		{PageSize: 10, SortBy: "hash"},
+		{PageSize: 10, Type: "x"},
+		{PageSize: 0},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected error for %+v", opts)
+		}
+	}
+}
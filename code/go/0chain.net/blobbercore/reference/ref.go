@@ -36,6 +36,17 @@ type Attributes struct {
 	// blobbers to be trusted.
 	WhoPaysForReads common.WhoPays `json:"who_pays_for_reads,omitempty"`
 
+	// The KeepVersions is the number of previous versions of a file kept
+	// when it's updated. Set on a directory, or on the root directory for
+	// the whole allocation, it applies to the files of its subtree which
+	// don't set it. It's a setting of the blobber, directory attributes
+	// aren't part of the hashes.
+	KeepVersions int `json:"keep_versions,omitempty"`
+
+	// The ExpiresAt is the time the blobber queues the deletion of a file
+	// for the owner to commit, never if zero.
+	ExpiresAt common.Timestamp `json:"expires_at,omitempty"`
+
 	// add more file / directory attributes by needs with
 	// 'omitempty' json tag to avoid hash difference for
 	// equal values
@@ -52,6 +63,14 @@ func (a *Attributes) Validate() (err error) {
 		return common.NewErrorf("validating_object_attributes",
 			"invalid who_pays_for_reads field: %v", err)
 	}
+	if a.KeepVersions < 0 || a.KeepVersions > MAX_KEEP_VERSIONS {
+		return common.NewErrorf("validating_object_attributes",
+			"invalid keep_versions field: should be from 0 to %d", MAX_KEEP_VERSIONS)
+	}
+	if a.ExpiresAt < 0 {
+		return common.NewError("validating_object_attributes",
+			"invalid expires_at field: should be a unix timestamp")
+	}
 	return
 }
 
@@ -81,6 +100,7 @@ type Ref struct {
 	ActualThumbnailHash string         `gorm:"column:actual_thumbnail_hash" filelist:"actual_thumbnail_hash"`
 	EncryptedKey        string         `gorm:"column:encrypted_key" filelist:"encrypted_key"`
 	Attributes          datatypes.JSON `gorm:"column:attributes" filelist:"attributes"`
+	XAttrs              datatypes.JSON `gorm:"column:xattrs" dirlist:"xattrs" filelist:"xattrs"`
 	Children            []*Ref         `gorm:"-"`
 	childrenLoaded      bool
 
@@ -104,6 +124,12 @@ func NewDirectoryRef() *Ref {
 	return &Ref{Type: DIRECTORY, Attributes: datatypes.JSON("{}")}
 }
 
+// NewEmptyDirectoryRef returns a new directory without children, hashed as
+// empty rather than as a directory whose children aren't loaded.
+func NewEmptyDirectoryRef() *Ref {
+	return &Ref{Type: DIRECTORY, Attributes: datatypes.JSON("{}"), childrenLoaded: true}
+}
+
 func NewFileRef() *Ref {
 	return &Ref{Type: FILE, Attributes: datatypes.JSON("{}")}
 }
@@ -231,6 +257,10 @@ func (fr *Ref) GetFileHashData() string {
 	hashArray = append(hashArray, strconv.FormatInt(fr.ActualFileSize, 10))
 	hashArray = append(hashArray, fr.ActualFileHash)
 	hashArray = append(hashArray, string(fr.Attributes))
+	// files without xattrs keep the hashes they had before xattrs
+	if xattrs := fr.xattrsHashData(); len(xattrs) != 0 {
+		hashArray = append(hashArray, xattrs)
+	}
 	return strings.Join(hashArray, ":")
 }
 
@@ -275,7 +305,11 @@ func (r *Ref) CalculateDirHash(ctx context.Context, saveToDB bool) (string, erro
 	}
 	// fmt.Println("ref name and path, hash :" + r.Name + " " + r.Path + " " + r.Hash)
 	// fmt.Println("ref hash data: " + strings.Join(childHashes, ":"))
-	r.Hash = encryption.Hash(strings.Join(childHashes, ":"))
+	hashData := strings.Join(childHashes, ":")
+	if xattrs := r.xattrsHashData(); len(xattrs) != 0 {
+		hashData += ":" + xattrs
+	}
+	r.Hash = encryption.Hash(hashData)
 	// fmt.Println("ref hash : " + r.Hash)
 	r.NumBlocks = refNumBlocks
 	r.Size = size
@@ -336,6 +370,30 @@ func DeleteReference(ctx context.Context, refID int64, pathHash string) error {
 	return db.Where("path_hash = ?", pathHash).Delete(&Ref{ID: refID}).Error
 }
 
+// CountContentReferences returns the number of file refs, in use or in the
+// trash, and file versions using the content hash for their content or their
+// thumbnail, within the allocation or within all allocations if the
+// allocation id is empty.
+func CountContentReferences(ctx context.Context, allocationID string, contentHash string) (count int64, err error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	queries := []*gorm.DB{
+		db.Unscoped().Model(&Ref{}).Where("deleted_at IS NULL OR id IN (?)", db.Model(&TrashRef{}).Select("ref_id")),
+		db.Model(&FileVersion{}),
+	}
+	for _, query := range queries {
+		var n int64
+		query = query.Where("content_hash = ? OR thumbnail_hash = ?", contentHash, contentHash)
+		if len(allocationID) != 0 {
+			query = query.Where("allocation_id = ?", allocationID)
+		}
+		if err = query.Count(&n).Error; err != nil {
+			return
+		}
+		count += n
+	}
+	return
+}
+
 func (r *Ref) Save(ctx context.Context) error {
 	db := datastore.GetStore().GetTransaction(ctx)
 	return db.Save(r).Error
@@ -0,0 +1,170 @@
+package reference
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// SearchOptions are the criteria of a search of the refs of an allocation.
+// Zero values don't filter. Results are sorted by path, a page starting
+// after the path of the cursor.
+type SearchOptions struct {
+	Path        string // subtree searched
+	PathPrefix  string
+	Name        string // glob with * and ?
+	NamePrefix  string
+	Type        string
+	MimeType    string // exact mimetype, or a prefix as "image/*"
+	MinSize     int64
+	MaxSize     int64
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	UpdatedFrom time.Time
+	UpdatedTo   time.Time
+	// CustomMeta are the keys the custom meta of files must have, with the
+	// value if not empty
+	CustomMeta map[string]string
+	// XAttrs are the keys the xattrs of the refs must have, with the value
+	// if not empty
+	XAttrs   map[string]string
+	PageSize int
+	Cursor   string
+}
+
+// escapeLike escapes the wildcards of LIKE patterns.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// globToLike converts a glob with * and ? to a LIKE pattern.
+func globToLike(glob string) string {
+	return strings.NewReplacer("*", "%", "?", "_").Replace(escapeLike(glob))
+}
+
+// encodeSearchCursor returns the cursor of the page after the path.
+func encodeSearchCursor(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(path))
+}
+
+// decodeSearchCursor returns the path of the cursor.
+func decodeSearchCursor(cursor string) (string, error) {
+	path, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", common.NewError("invalid_parameters", "Invalid cursor")
+	}
+	return string(path), nil
+}
+
+// Validate checks the options.
+func (opts *SearchOptions) Validate() error {
+	if opts.Type != "" && opts.Type != FILE && opts.Type != DIRECTORY {
+		return common.NewError("invalid_parameters", "Invalid type filter")
+	}
+	if opts.PageSize <= 0 {
+		return common.NewError("invalid_parameters", "Invalid page size")
+	}
+	if opts.MaxSize > 0 && opts.MaxSize < opts.MinSize {
+		return common.NewError("invalid_parameters", "Invalid size range")
+	}
+	_, err := decodeSearchCursor(opts.Cursor)
+	return err
+}
+
+// SearchRefs returns a page of the refs of the allocation matching the
+// options, and the cursor of the next page, empty on the last page.
+func SearchRefs(ctx context.Context, allocationID string, opts *SearchOptions) ([]*Ref, string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, "", err
+	}
+	db := datastore.GetStore().GetTransaction(ctx)
+	query := db.Model(&Ref{}).Where("allocation_id = ?", allocationID)
+	if len(opts.Path) != 0 && opts.Path != "/" {
+		query = query.Where("path LIKE ?", escapeLike(opts.Path)+"/%")
+	}
+	if len(opts.PathPrefix) != 0 {
+		query = query.Where("path LIKE ?", escapeLike(opts.PathPrefix)+"%")
+	}
+	if len(opts.Name) != 0 {
+		query = query.Where("name LIKE ?", globToLike(opts.Name))
+	}
+	if len(opts.NamePrefix) != 0 {
+		query = query.Where("name LIKE ?", escapeLike(opts.NamePrefix)+"%")
+	}
+	if len(opts.Type) != 0 {
+		query = query.Where("type = ?", opts.Type)
+	}
+	if strings.HasSuffix(opts.MimeType, "/*") {
+		query = query.Where("mimetype LIKE ?", escapeLike(strings.TrimSuffix(opts.MimeType, "*"))+"%")
+	} else if len(opts.MimeType) != 0 {
+		query = query.Where("mimetype = ?", opts.MimeType)
+	}
+	if opts.MinSize > 0 {
+		query = query.Where("size >= ?", opts.MinSize)
+	}
+	if opts.MaxSize > 0 {
+		query = query.Where("size <= ?", opts.MaxSize)
+	}
+	if !opts.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", opts.CreatedFrom)
+	}
+	if !opts.CreatedTo.IsZero() {
+		query = query.Where("created_at <= ?", opts.CreatedTo)
+	}
+	if !opts.UpdatedFrom.IsZero() {
+		query = query.Where("updated_at >= ?", opts.UpdatedFrom)
+	}
+	if !opts.UpdatedTo.IsZero() {
+		query = query.Where("updated_at <= ?", opts.UpdatedTo)
+	}
+	for key, value := range opts.CustomMeta {
+		if len(value) == 0 {
+			query = query.Where("jsonb_exists(custom_meta_json(custom_meta), ?)", key)
+		} else {
+			query = query.Where("custom_meta_json(custom_meta) ->> ? = ?", key, value)
+		}
+	}
+	// the operators of the GIN index of the xattrs
+	for key, value := range opts.XAttrs {
+		if len(value) == 0 {
+			query = query.Where(jsonbHasKey{Column: "xattrs", Key: key})
+		} else {
+			b, _ := json.Marshal(map[string]string{key: value})
+			query = query.Where("xattrs @> ?::jsonb", string(b))
+		}
+	}
+	if len(opts.Cursor) != 0 {
+		cursor, _ := decodeSearchCursor(opts.Cursor)
+		query = query.Where("path > ?", cursor)
+	}
+
+	var refs []*Ref
+	err := query.Order("path").Limit(opts.PageSize + 1).Find(&refs).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if len(refs) <= opts.PageSize {
+		return refs, "", nil
+	}
+	refs = refs[:opts.PageSize]
+	return refs, encodeSearchCursor(refs[len(refs)-1].Path), nil
+}
+
+// jsonbHasKey is the condition of a JSONB column having the key, with the ?
+// operator gorm would take for a placeholder in a string condition.
+type jsonbHasKey struct {
+	Column string
+	Key    string
+}
+
+func (e jsonbHasKey) Build(builder clause.Builder) {
+	builder.WriteString(e.Column + " ? ")
+	builder.AddVar(builder, e.Key)
+}
@@ -0,0 +1,53 @@
+package reference
+
+import "testing"
+
+func TestSearchPatterns(t *testing.T) {
+	tests := []struct {
+		in, escaped, like string
+	}{
+		{"plain", "plain", "plain"},
+		{"100%_done", `100\%\_done`, `100\%\_done`},
+		{`back\slash`, `back\\slash`, `back\\slash`},
+		{"*.txt", "*.txt", "%.txt"},
+		{"file?_*", `file?\_*`, `file_\_%`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.escaped {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.escaped)
+		}
+		if got := globToLike(tt.in); got != tt.like {
+			t.Errorf("globToLike(%q) = %q, want %q", tt.in, got, tt.like)
+		}
+	}
+}
+
+func TestSearchOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts SearchOptions
+		fail bool
+	}{
+		{opts: SearchOptions{PageSize: 10}},
+		{opts: SearchOptions{PageSize: 10, Type: FILE, MinSize: 10, MaxSize: 10}},
+		{opts: SearchOptions{PageSize: 10, MinSize: 10}},
+		{opts: SearchOptions{PageSize: 10, Cursor: encodeSearchCursor("/a/b")}},
+		{opts: SearchOptions{PageSize: 0}, fail: true},
+		{opts: SearchOptions{PageSize: 10, Type: "x"}, fail: true},
+		{opts: SearchOptions{PageSize: 10, MinSize: 10, MaxSize: 5}, fail: true},
+		{opts: SearchOptions{PageSize: 10, Cursor: "not a cursor"}, fail: true},
+	}
+	for idx, tt := range tests {
+		if err := tt.opts.Validate(); (err != nil) != tt.fail {
+			t.Errorf("%d: got error %v, want failure %v", idx, err, tt.fail)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	for _, path := range []string{"", "/", "/a dir/file?.txt", "/ünïcode/päth"} {
+		got, err := decodeSearchCursor(encodeSearchCursor(path))
+		if err != nil || got != path {
+			t.Errorf("got %q (%v), want %q", got, err, path)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package reference
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/common"
+
+	"gorm.io/gorm"
+)
+
+// TrashEntry is a file or a directory deleted with its subtree, its refs
+// being kept soft-deleted with their content until the entry expires.
+type TrashEntry struct {
+	ID           int64     `gorm:"column:id;primary_key" json:"id"`
+	AllocationID string    `gorm:"column:allocation_id" json:"-"`
+	RefID        int64     `gorm:"column:ref_id" json:"-"`
+	Path         string    `gorm:"column:path" json:"path"`
+	Name         string    `gorm:"column:name" json:"name"`
+	Type         string    `gorm:"column:type" json:"type"`
+	Size         int64     `gorm:"column:size" json:"size"`
+	DeletedAt    time.Time `gorm:"column:deleted_at" json:"deleted_at"`
+	ExpiresAt    time.Time `gorm:"column:expires_at" json:"expires_at"`
+}
+
+func (TrashEntry) TableName() string {
+	return "trash_entries"
+}
+
+// TrashRef links a trash entry to a ref of its subtree.
+type TrashRef struct {
+	EntryID int64 `gorm:"column:entry_id"`
+	RefID   int64 `gorm:"column:ref_id"`
+}
+
+func (TrashRef) TableName() string {
+	return "trash_refs"
+}
+
+// AddTrashEntry records the deleted ref, with the refs of its subtree, in
+// the trash until the expiry time.
+func AddTrashEntry(ctx context.Context, ref *Ref, subtree []*Ref, expiresAt time.Time) (*TrashEntry, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	entry := &TrashEntry{
+		AllocationID: ref.AllocationID,
+		RefID:        ref.ID,
+		Path:         ref.Path,
+		Name:         ref.Name,
+		Type:         ref.Type,
+		Size:         ref.Size,
+		DeletedAt:    time.Now(),
+		ExpiresAt:    expiresAt,
+	}
+	if err := db.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	for _, subtreeRef := range append([]*Ref{ref}, subtree...) {
+		err := db.Create(&TrashRef{EntryID: entry.ID, RefID: subtreeRef.ID}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// GetTrashEntries returns a page of the trash entries of the allocation,
+// latest first, after the entry id of the cursor if not zero.
+func GetTrashEntries(ctx context.Context, allocationID string, cursor int64, pageSize int) ([]*TrashEntry, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	query := db.Where("allocation_id = ?", allocationID)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	var entries []*TrashEntry
+	err := query.Order("id DESC").Limit(pageSize).Find(&entries).Error
+	return entries, err
+}
+
+// GetTrashEntry returns the trash entry of the allocation with the id.
+func GetTrashEntry(ctx context.Context, allocationID string, id int64) (*TrashEntry, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	entry := &TrashEntry{}
+	err := db.Where("allocation_id = ? AND id = ?", allocationID, id).First(entry).Error
+	if err != nil {
+		return nil, common.NewErrorf("invalid_parameters", "Trash entry %d not found", id)
+	}
+	return entry, nil
+}
+
+// GetExpiredTrashEntries returns the trash entries expired at the time.
+func GetExpiredTrashEntries(ctx context.Context, now time.Time, limit int) ([]*TrashEntry, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var entries []*TrashEntry
+	err := db.Where("expires_at <= ?", now).Order("expires_at").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// GetTrashedRefs returns the soft-deleted refs of the trash entry, parents
+// first.
+func GetTrashedRefs(ctx context.Context, entry *TrashEntry) ([]*Ref, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var refs []*Ref
+	err := db.Unscoped().Where("id IN (?)", db.Model(&TrashRef{}).Select("ref_id").Where("entry_id = ?", entry.ID)).
+		Order("level, id").Find(&refs).Error
+	return refs, err
+}
+
+// DeleteTrashEntry removes the entry from the trash.
+func DeleteTrashEntry(ctx context.Context, entry *TrashEntry) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	if err := db.Where("entry_id = ?", entry.ID).Delete(&TrashRef{}).Error; err != nil {
+		return err
+	}
+	return db.Delete(entry).Error
+}
+
+// RestoreTrashedRefs undeletes the refs of a trash entry, parents first,
+// moving them from the path of the entry to the new path. It returns the
+// top ref with its subtree, to be added to the parent directory.
+func RestoreTrashedRefs(refs []*Ref, oldPath string, newPath string) (*Ref, error) {
+	if len(refs) == 0 || refs[0].Path != oldPath {
+		return nil, common.NewError("invalid_trash_entry", "Trash entry has no refs to restore")
+	}
+	dirs := make(map[string]*Ref)
+	top := refs[0]
+	for _, ref := range refs {
+		path := newPath + strings.TrimPrefix(ref.Path, oldPath)
+		ref.UpdatePath(path, filepath.Dir(path))
+		ref.Name = filepath.Base(path)
+		ref.DeletedAt = gorm.DeletedAt{}
+		ref.Children = nil
+		if ref.Type == DIRECTORY {
+			ref.childrenLoaded = true
+			dirs[ref.Path] = ref
+		}
+		if ref == top {
+			continue
+		}
+		parent, ok := dirs[ref.ParentPath]
+		if !ok {
+			return nil, common.NewError("invalid_trash_entry", "Trash entry has an invalid tree")
+		}
+		parent.AddChild(ref)
+	}
+	return top, nil
+}
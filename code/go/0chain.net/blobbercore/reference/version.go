@@ -0,0 +1,164 @@
+package reference
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"0chain.net/blobbercore/datastore"
+	"0chain.net/core/common"
+)
+
+const MAX_KEEP_VERSIONS = 100
+
+// FileVersion is a previous content of a file, kept when the file is
+// updated if versioning is enabled for it. The versions of a file are
+// numbered from 1, the latest having the highest number.
+type FileVersion struct {
+	ID                  int64     `gorm:"column:id;primary_key" json:"-"`
+	RefID               int64     `gorm:"column:ref_id" json:"-"`
+	AllocationID        string    `gorm:"column:allocation_id" json:"-"`
+	Version             int64     `gorm:"column:version" json:"version"`
+	ContentHash         string    `gorm:"column:content_hash" json:"content_hash"`
+	MerkleRoot          string    `gorm:"column:merkle_root" json:"merkle_root"`
+	Size                int64     `gorm:"column:size" json:"size"`
+	ActualFileSize      int64     `gorm:"column:actual_file_size" json:"actual_file_size"`
+	ActualFileHash      string    `gorm:"column:actual_file_hash" json:"actual_file_hash"`
+	MimeType            string    `gorm:"column:mimetype" json:"mimetype"`
+	CustomMeta          string    `gorm:"column:custom_meta" json:"custom_meta"`
+	ThumbnailSize       int64     `gorm:"column:thumbnail_size" json:"thumbnail_size"`
+	ThumbnailHash       string    `gorm:"column:thumbnail_hash" json:"thumbnail_hash"`
+	ActualThumbnailSize int64     `gorm:"column:actual_thumbnail_size" json:"actual_thumbnail_size"`
+	ActualThumbnailHash string    `gorm:"column:actual_thumbnail_hash" json:"actual_thumbnail_hash"`
+	EncryptedKey        string    `gorm:"column:encrypted_key" json:"encrypted_key"`
+	WriteMarker         string    `gorm:"column:write_marker" json:"write_marker"`
+	OnCloud             bool      `gorm:"column:on_cloud" json:"on_cloud"`
+	ModifiedAt          time.Time `gorm:"column:modified_at" json:"modified_at"`
+	CreatedAt           time.Time `gorm:"column:created_at" json:"created_at"`
+}
+
+func (FileVersion) TableName() string {
+	return "file_versions"
+}
+
+// ContentHashes returns the hashes of the objects the version keeps.
+func (fv *FileVersion) ContentHashes() []string {
+	if len(fv.ThumbnailHash) == 0 {
+		return []string{fv.ContentHash}
+	}
+	return []string{fv.ContentHash, fv.ThumbnailHash}
+}
+
+// GetKeepVersions returns the number of versions to keep for the file at
+// the path, set on the file or else on its nearest directory setting it.
+// The reference path from the root to the file should be loaded. Values
+// beyond MAX_KEEP_VERSIONS, set with the upload of a file, are capped.
+func GetKeepVersions(rootRef *Ref, path string) int {
+	keep := 0
+	dirRef := rootRef
+	for {
+		if attr, err := dirRef.GetAttributes(); err == nil && attr.KeepVersions > 0 {
+			keep = attr.KeepVersions
+			if keep > MAX_KEEP_VERSIONS {
+				keep = MAX_KEEP_VERSIONS
+			}
+		}
+		if dirRef.Path == path {
+			return keep
+		}
+		var next *Ref
+		for _, child := range dirRef.Children {
+			if child.Path == path || (child.Type == DIRECTORY && isAncestor(child.Path, path)) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return keep
+		}
+		dirRef = next
+	}
+}
+
+func isAncestor(dir string, path string) bool {
+	for p := filepath.Dir(path); p != "/" && p != "."; p = filepath.Dir(p) {
+		if p == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFileVersion keeps the current content of the file as its latest
+// version.
+func AddFileVersion(ctx context.Context, fileRef *Ref) (*FileVersion, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var latest int64
+	err := db.Model(&FileVersion{}).Where("ref_id = ?", fileRef.ID).
+		Select("COALESCE(MAX(version), 0)").Row().Scan(&latest)
+	if err != nil {
+		return nil, err
+	}
+	version := &FileVersion{
+		RefID:               fileRef.ID,
+		AllocationID:        fileRef.AllocationID,
+		Version:             latest + 1,
+		ContentHash:         fileRef.ContentHash,
+		MerkleRoot:          fileRef.MerkleRoot,
+		Size:                fileRef.Size,
+		ActualFileSize:      fileRef.ActualFileSize,
+		ActualFileHash:      fileRef.ActualFileHash,
+		MimeType:            fileRef.MimeType,
+		CustomMeta:          fileRef.CustomMeta,
+		ThumbnailSize:       fileRef.ThumbnailSize,
+		ThumbnailHash:       fileRef.ThumbnailHash,
+		ActualThumbnailSize: fileRef.ActualThumbnailSize,
+		ActualThumbnailHash: fileRef.ActualThumbnailHash,
+		EncryptedKey:        fileRef.EncryptedKey,
+		WriteMarker:         fileRef.WriteMarker,
+		OnCloud:             fileRef.OnCloud,
+		ModifiedAt:          fileRef.UpdatedAt,
+	}
+	return version, db.Create(version).Error
+}
+
+// GetFileVersions returns the versions of the file, latest first.
+func GetFileVersions(ctx context.Context, refID int64) ([]*FileVersion, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var versions []*FileVersion
+	err := db.Where("ref_id = ?", refID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// GetFileVersion returns the version of the file with the number.
+func GetFileVersion(ctx context.Context, refID int64, version int64) (*FileVersion, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	fileVersion := &FileVersion{}
+	err := db.Where("ref_id = ? AND version = ?", refID, version).First(fileVersion).Error
+	if err != nil {
+		return nil, common.NewErrorf("invalid_parameters", "Version %d of the file not found", version)
+	}
+	return fileVersion, nil
+}
+
+// DeleteFileVersion deletes the version of the file.
+func DeleteFileVersion(ctx context.Context, fileVersion *FileVersion) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Delete(fileVersion).Error
+}
+
+// PruneFileVersions deletes the versions of the file but the latest ones to
+// keep, and returns the deleted versions.
+func PruneFileVersions(ctx context.Context, refID int64, keep int) ([]*FileVersion, error) {
+	versions, err := GetFileVersions(ctx, refID)
+	if err != nil || len(versions) <= keep {
+		return nil, err
+	}
+	pruned := versions[keep:]
+	for _, version := range pruned {
+		if err = DeleteFileVersion(ctx, version); err != nil {
+			return nil, err
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,78 @@
+package reference
+
+import (
+	"encoding/json"
+
+	"0chain.net/core/common"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	MAX_XATTR_KEY_LENGTH   = 255
+	MAX_XATTR_VALUE_LENGTH = 1024
+	MAX_XATTRS_SIZE        = 8 * 1024
+)
+
+// ValidateXAttrs checks the keys and values of xattrs and their total size.
+func ValidateXAttrs(xattrs map[string]string) error {
+	var size int
+	for key, value := range xattrs {
+		if len(key) == 0 || len(key) > MAX_XATTR_KEY_LENGTH {
+			return common.NewErrorf("invalid_xattrs", "Invalid key %q, should be 1 to %d bytes", key, MAX_XATTR_KEY_LENGTH)
+		}
+		if len(value) > MAX_XATTR_VALUE_LENGTH {
+			return common.NewErrorf("invalid_xattrs", "Invalid value of %q, should be at most %d bytes", key, MAX_XATTR_VALUE_LENGTH)
+		}
+		size += len(key) + len(value)
+	}
+	if size > MAX_XATTRS_SIZE {
+		return common.NewErrorf("invalid_xattrs", "Too large xattrs, should be at most %d bytes", MAX_XATTRS_SIZE)
+	}
+	return nil
+}
+
+// GetXAttrs returns the user key/value metadata of the ref.
+func (r *Ref) GetXAttrs() (map[string]string, error) {
+	xattrs := make(map[string]string)
+	if len(r.XAttrs) == 0 {
+		return xattrs, nil
+	}
+	if err := json.Unmarshal([]byte(r.XAttrs), &xattrs); err != nil {
+		return nil, common.NewError("decoding_xattrs", err.Error())
+	}
+	return xattrs, nil
+}
+
+// SetXAttrs validates and sets the user key/value metadata of the ref, none
+// if empty. The children of a directory must be loaded, it's hashed with its
+// xattrs.
+func (r *Ref) SetXAttrs(xattrs map[string]string) error {
+	if err := ValidateXAttrs(xattrs); err != nil {
+		return err
+	}
+	if r.Type == DIRECTORY {
+		r.childrenLoaded = true
+	}
+	if len(xattrs) == 0 {
+		r.XAttrs = nil
+		return nil
+	}
+	b, err := json.Marshal(xattrs)
+	if err != nil {
+		return common.NewError("encoding_xattrs", err.Error())
+	}
+	r.XAttrs = datatypes.JSON(b)
+	return nil
+}
+
+// xattrsHashData returns the xattrs of the ref as hashed, with sorted keys
+// as the database doesn't keep the JSON text, or empty without xattrs.
+func (r *Ref) xattrsHashData() string {
+	xattrs, err := r.GetXAttrs()
+	if err != nil || len(xattrs) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(xattrs)
+	return string(b)
+}
@@ -0,0 +1,92 @@
+package reference
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm/clause"
+)
+
+func TestValidateXAttrs(t *testing.T) {
+	valid := []map[string]string{
+		nil,
+		{"key": ""},
+		{"key": "value", strings.Repeat("k", MAX_XATTR_KEY_LENGTH): strings.Repeat("v", MAX_XATTR_VALUE_LENGTH)},
+	}
+	for _, xattrs := range valid {
+		if err := ValidateXAttrs(xattrs); err != nil {
+			t.Errorf("%v: %v", xattrs, err)
+		}
+	}
+
+	tooLarge := make(map[string]string)
+	for i := 0; i < MAX_XATTRS_SIZE/MAX_XATTR_VALUE_LENGTH; i++ {
+		tooLarge[fmt.Sprintf("key%d", i)] = strings.Repeat("v", MAX_XATTR_VALUE_LENGTH)
+	}
+	invalid := []map[string]string{
+		{"": "value"},
+		{strings.Repeat("k", MAX_XATTR_KEY_LENGTH+1): "value"},
+		{"key": strings.Repeat("v", MAX_XATTR_VALUE_LENGTH+1)},
+		tooLarge,
+	}
+	for _, xattrs := range invalid {
+		if err := ValidateXAttrs(xattrs); err == nil {
+			t.Errorf("expected an error for %d xattrs", len(xattrs))
+		}
+	}
+}
+
+func TestXAttrsHashData(t *testing.T) {
+	ref := &Ref{}
+	if data := ref.xattrsHashData(); data != "" {
+		t.Errorf("hash data without xattrs: %q", data)
+	}
+	// the keys are sorted whatever the order they're stored in
+	ref.XAttrs = datatypes.JSON(`{"b": "2", "a": "1"}`)
+	if data, expected := ref.xattrsHashData(), `{"a":"1","b":"2"}`; data != expected {
+		t.Errorf("hash data: %q, expected %q", data, expected)
+	}
+	if err := ref.SetXAttrs(nil); err != nil || ref.XAttrs != nil || ref.xattrsHashData() != "" {
+		t.Errorf("xattrs not cleared: %q, %v", ref.XAttrs, err)
+	}
+}
+
+func TestFileHashDataWithoutXAttrs(t *testing.T) {
+	ref := &Ref{AllocationID: "alloc", Type: FILE, Name: "file", Path: "/file", Size: 10,
+		ContentHash: "content", MerkleRoot: "merkle", ActualFileSize: 5, ActualFileHash: "actual"}
+	expected := "alloc:f:file:/file:10:content:merkle:5:actual:{}"
+	if data := ref.GetFileHashData(); data != expected {
+		t.Errorf("hash data: %q, expected %q", data, expected)
+	}
+
+	if err := ref.SetXAttrs(map[string]string{"key": "value"}); err != nil {
+		t.Fatal(err)
+	}
+	if data := ref.GetFileHashData(); data != expected+`:{"key":"value"}` {
+		t.Errorf("hash data with xattrs: %q", data)
+	}
+}
+
+type testBuilder struct {
+	strings.Builder
+	vars []interface{}
+}
+
+func (b *testBuilder) WriteQuoted(field interface{}) {}
+
+func (b *testBuilder) AddVar(w clause.Writer, vars ...interface{}) {
+	for _, v := range vars {
+		b.vars = append(b.vars, v)
+		w.WriteString(fmt.Sprintf("$%d", len(b.vars)))
+	}
+}
+
+func TestJSONBHasKey(t *testing.T) {
+	builder := &testBuilder{}
+	jsonbHasKey{Column: "xattrs", Key: "key"}.Build(builder)
+	if sql := builder.String(); sql != "xattrs ? $1" || len(builder.vars) != 1 || builder.vars[0] != "key" {
+		t.Errorf("unexpected condition %q with %v", sql, builder.vars)
+	}
+}
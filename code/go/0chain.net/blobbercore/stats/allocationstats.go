@@ -30,6 +30,11 @@ func (fs *AllocationStats) loadAllocationDiskUsageStats() error {
 		du = -1
 	}
 	fs.DiskSizeUsed = du
+	lu, err := filestore.GetFileStore().GetLogicalDiskSizeUsed(fs.AllocationID)
+	if err != nil {
+		lu = -1
+	}
+	fs.LogicalSizeUsed = lu
 	tfs, err := filestore.GetFileStore().GetTempPathSize(fs.AllocationID)
 	if err != nil {
 		tfs = -1
@@ -46,6 +46,7 @@ type Stats struct {
 	FilesSize          int64 `json:"files_size"`
 	ThumbnailsSize     int64 `json:"thumbnails_size"`
 	DiskSizeUsed       int64 `json:"disk_size_used"`
+	LogicalSizeUsed    int64 `json:"logical_size_used"`
 	BlockWrites        int64 `json:"num_of_block_writes"`
 	NumWrites          int64 `json:"num_of_writes"`
 	NumReads           int64 `json:"num_of_reads"`
@@ -62,6 +63,10 @@ type MinioStats struct {
 	CloudFilesSize  int64  `json:"cloud_files_size"`
 	CloudTotalFiles int    `json:"cloud_total_files"`
 	LastMinioScan   string `json:"last_minio_scan"`
+	// reads of files served by the local disk and by the cloud
+	LocalTierReads int64   `json:"local_tier_reads"`
+	ColdTierReads  int64   `json:"cold_tier_reads"`
+	LocalTierRate  float64 `json:"local_tier_rate"`
 }
 
 type Duration int64
@@ -124,6 +129,11 @@ func (bs *BlobberStats) loadBasicStats(ctx context.Context) {
 		du = -1
 	}
 	bs.DiskSizeUsed = du
+	lu, err := filestore.GetFileStore().GetTotalLogicalDiskSizeUsed()
+	if err != nil {
+		lu = -1
+	}
+	bs.LogicalSizeUsed = lu
 	bs.loadStats(ctx)
 	bs.loadMinioStats(ctx)
 }
@@ -228,6 +238,10 @@ func (bs *BlobberStats) loadMinioStats(ctx context.Context) {
 	}
 
 	bs.LastMinioScan = LastMinioScan.Format(DateTimeFormat)
+	bs.LocalTierReads, bs.ColdTierReads = filestore.GetTierReads()
+	if reads := bs.LocalTierReads + bs.ColdTierReads; reads > 0 {
+		bs.LocalTierRate = float64(bs.LocalTierReads) / float64(reads)
+	}
 }
 
 func (bs *BlobberStats) loadAllocationStats(ctx context.Context) {
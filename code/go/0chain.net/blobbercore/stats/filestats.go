@@ -2,6 +2,7 @@ package stats
 
 import (
 	"context"
+	"time"
 
 	"0chain.net/blobbercore/datastore"
 
@@ -9,14 +10,16 @@ import (
 )
 
 type FileStats struct {
-	ID                       int64  `gorm:column:id;primary_key json:"-"`
-	RefID                    int64  `gorm:"column:ref_id" json:"-"`
-	NumUpdates               int64  `gorm:"column:num_of_updates" json:"num_of_updates"`
-	NumBlockDownloads        int64  `gorm:"column:num_of_block_downloads" json:"num_of_block_downloads"`
-	SuccessChallenges        int64  `gorm:"column:num_of_challenges" json:"num_of_challenges"`
-	FailedChallenges         int64  `gorm:"column:num_of_failed_challenges" json:"num_of_failed_challenges"`
-	LastChallengeResponseTxn string `gorm:"column:last_challenge_txn" json:"last_challenge_txn"`
-	WriteMarkerRedeemTxn     string `gorm:"-" json:"write_marker_txn"`
+	ID                       int64     `gorm:column:id;primary_key json:"-"`
+	RefID                    int64     `gorm:"column:ref_id" json:"-"`
+	NumUpdates               int64     `gorm:"column:num_of_updates" json:"num_of_updates"`
+	NumBlockDownloads        int64     `gorm:"column:num_of_block_downloads" json:"num_of_block_downloads"`
+	SuccessChallenges        int64     `gorm:"column:num_of_challenges" json:"num_of_challenges"`
+	FailedChallenges         int64     `gorm:"column:num_of_failed_challenges" json:"num_of_failed_challenges"`
+	LastChallengeResponseTxn string    `gorm:"column:last_challenge_txn" json:"last_challenge_txn"`
+	WriteMarkerRedeemTxn     string    `gorm:"-" json:"write_marker_txn"`
+	LastAccessedAt           time.Time `gorm:"column:last_accessed_at" json:"last_accessed_at"`
+	NumColdReads             int64     `gorm:"column:num_of_cold_reads" json:"num_of_cold_reads"`
 	datastore.ModelWithTS
 
 	//NumBlockWrites           int64  `gorm:"column:num_of_block_writes" json:"num_of_block_writes"`
@@ -31,6 +34,7 @@ func NewFileCreated(ctx context.Context, refID int64) {
 	stats := &FileStats{RefID: refID}
 	stats.NumBlockDownloads = 0
 	stats.NumUpdates = 1
+	stats.LastAccessedAt = time.Now()
 	db.Save(stats)
 }
 
@@ -46,6 +50,17 @@ func FileBlockDownloaded(ctx context.Context, refID int64) {
 	db.Model(stats).Where(FileStats{RefID: refID}).Update("num_of_block_downloads", gorm.Expr("num_of_block_downloads + ?", 1))
 }
 
+// FileAccessed records a read of the file, counting reads served by the cold
+// tier separately.
+func FileAccessed(ctx context.Context, refID int64, onCloud bool) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	updates := map[string]interface{}{"last_accessed_at": gorm.Expr("NOW()")}
+	if onCloud {
+		updates["num_of_cold_reads"] = gorm.Expr("num_of_cold_reads + ?", 1)
+	}
+	db.Model(&FileStats{}).Where(FileStats{RefID: refID}).Updates(updates)
+}
+
 func GetFileStats(ctx context.Context, refID int64) (*FileStats, error) {
 	db := datastore.GetStore().GetTransaction(ctx)
 	stats := &FileStats{RefID: refID}
@@ -39,6 +39,9 @@ var funcMap = template.FuncMap{
 	"write_size": func(readCount int64) string {
 		return byteCountIEC(readCount)
 	},
+	"percent": func(rate float64) string {
+		return fmt.Sprintf("%.1f%%", rate*100)
+	},
 }
 
 const tpl = `<!DOCTYPE html>
@@ -71,6 +74,10 @@ const tpl = `<!DOCTYPE html>
         <td>Actual Disk Usage (bytes)</td>
         <td>{{ .DiskSizeUsed }}</td>
       </tr>
+      <tr>
+        <td>Uncompressed Disk Usage (bytes)</td>
+        <td>{{ .LogicalSizeUsed }}</td>
+      </tr>
       <tr>
         <td>Cloud Files Size (bytes)</td>
         <td>{{ .CloudFilesSize }}</td>
@@ -83,6 +90,14 @@ const tpl = `<!DOCTYPE html>
         <td>Last Minio Scan</td>
         <td>{{ .LastMinioScan }}</td>
       </tr>
+      <tr>
+        <td>Reads from local disk (hits)</td>
+        <td>{{ .LocalTierReads }} <i>({{ percent .LocalTierRate }})</i></td>
+      </tr>
+      <tr>
+        <td>Reads from cloud (misses)</td>
+        <td>{{ .ColdTierReads }}</td>
+      </tr>
       <tr>
         <td>Num of files</td>
         <td>{{ .NumWrites }}</td>
@@ -178,6 +193,7 @@ const tpl = `<!DOCTYPE html>
         <td>ID</td>
         <td>Used Size (bytes)</td>
         <td>Actual Disk Usage (bytes)</td>
+        <td>Uncompressed Disk Usage (bytes)</td>
         <td>Temp Folder Size (bytes)</td>
         <td>Num of files</td>
         <td>Blocks Written</td>
@@ -195,6 +211,7 @@ const tpl = `<!DOCTYPE html>
         <td rowspan=2>{{ .AllocationID }}</td>
         <td>{{ .UsedSize }}</td>
         <td>{{ .DiskSizeUsed }}</td>
+        <td>{{ .LogicalSizeUsed }}</td>
         <td>{{ .TempFolderSize }}</td>
         <td>{{ .NumWrites }}</td>
         <td>{{ .BlockWrites }}</td>
@@ -302,3 +319,19 @@ func GetStatsHandler(ctx context.Context, r *http.Request) (interface{}, error)
 	bs.loadBasicStats(ctx)
 	return bs, nil
 }
+
+// ScrubStatsHandler lists the objects found corrupt or missing by the scrub
+// worker.
+func ScrubStatsHandler(ctx context.Context, r *http.Request) (interface{}, error) {
+	ctx = datastore.GetStore().CreateTransaction(ctx)
+	db := datastore.GetStore().GetTransaction(ctx)
+	defer db.Rollback()
+	results, err := GetFailedScrubResults(ctx, r.FormValue("allocation_id"))
+	if err != nil {
+		return nil, common.NewError("scrub_stats_error", "Error reading the scrub results. "+err.Error())
+	}
+	response := make(map[string]interface{})
+	response["last_scrub"] = GetLastScrub().Format(DateTimeFormat)
+	response["objects"] = results
+	return response, nil
+}
@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"0chain.net/blobbercore/datastore"
+)
+
+const (
+	ScrubStatusOK       = "ok"
+	ScrubStatusCorrupt  = "corrupt"
+	ScrubStatusMissing  = "missing"
+	ScrubStatusRestored = "restored"
+)
+
+var (
+	lastScrub      time.Time
+	lastScrubMutex sync.RWMutex
+)
+
+// GetLastScrub returns the time the scrub worker last finished a pass.
+func GetLastScrub() time.Time {
+	lastScrubMutex.RLock()
+	defer lastScrubMutex.RUnlock()
+	return lastScrub
+}
+
+// SetLastScrub records the time the scrub worker finished a pass.
+func SetLastScrub(t time.Time) {
+	lastScrubMutex.Lock()
+	defer lastScrubMutex.Unlock()
+	lastScrub = t
+}
+
+// ScrubResult is the outcome of the last scrub of the objects of a file ref,
+// its content and its thumbnail. The path isn't listed by the scrub stats,
+// which aren't restricted to the owners of the allocations.
+type ScrubResult struct {
+	RefID          int64     `gorm:"column:ref_id;primary_key" json:"ref_id"`
+	AllocationID   string    `gorm:"column:allocation_id" json:"allocation_id"`
+	Path           string    `gorm:"column:path" json:"-"`
+	ContentHash    string    `gorm:"column:content_hash" json:"content_hash"`
+	Status         string    `gorm:"column:status" json:"status"`
+	Error          string    `gorm:"column:error" json:"error,omitempty"`
+	LastScrubbedAt time.Time `gorm:"column:last_scrubbed_at" json:"last_scrubbed_at"`
+	datastore.ModelWithTS
+}
+
+func (ScrubResult) TableName() string {
+	return "scrub_results"
+}
+
+// Save records the result, replacing the result of the previous scrub.
+func (sr *ScrubResult) Save(ctx context.Context) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Save(sr).Error
+}
+
+// GetFailedScrubResults returns the refs found corrupt or missing by their
+// last scrub, optionally only of the given allocation.
+func GetFailedScrubResults(ctx context.Context, allocationID string) (
+	results []*ScrubResult, err error) {
+
+	db := datastore.GetStore().GetTransaction(ctx)
+	query := db.Where("status IN (?,?)", ScrubStatusCorrupt, ScrubStatusMissing)
+	if len(allocationID) != 0 {
+		query = query.Where("allocation_id = ?", allocationID)
+	}
+	err = query.Order("last_scrubbed_at DESC").Find(&results).Error
+	return
+}
+
+// DeleteStaleScrubResults deletes the results of the refs of the allocation
+// which don't exist anymore.
+func DeleteStaleScrubResults(ctx context.Context, allocationID string) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	return db.Where("allocation_id = ? AND ref_id NOT IN (?)", allocationID,
+		db.Table("reference_objects").Select("id").
+			Where("allocation_id = ? AND deleted_at IS NULL", allocationID)).
+		Delete(&ScrubResult{}).Error
+}
@@ -108,6 +108,68 @@ func GetWriteMarkerEntity(ctx context.Context, allocation_root string) (*WriteMa
 	return wm, nil
 }
 
+// GetWriteMarkerSequence returns the sequence of the write marker of the
+// allocation root, to read the refs as of the allocation root.
+func GetWriteMarkerSequence(ctx context.Context, allocationID string, allocationRoot string) (int64, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var records []*WriteMarkerRecord
+	err := db.Where(WriteMarker{AllocationRoot: allocationRoot, AllocationID: allocationID}).
+		Limit(1).Find(&records).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, common.NewError("write_marker_not_found", "Could not find the write marker of the allocation root")
+	}
+	if !records[0].History {
+		return 0, common.NewError("history_not_available", "The history of the allocation doesn't go back to the allocation root")
+	}
+	return records[0].Sequence, nil
+}
+
+// WriteMarkerRecord is a write marker entity with its sequence number in
+// the write markers of the blobber, and whether the refs as of the write
+// marker can be read.
+type WriteMarkerRecord struct {
+	WriteMarkerEntity
+	Sequence int64 `gorm:"column:sequence"`
+	History  bool  `gorm:"column:history"`
+}
+
+// PruneHistory deletes the versions of the refs of the allocation only the
+// write markers before the latest keep ones need. Their refs can't be read
+// anymore.
+func PruneHistory(ctx context.Context, allocationID string, keep int) error {
+	db := datastore.GetStore().GetTransaction(ctx)
+	var sequences []int64
+	err := db.Table((WriteMarkerEntity{}).TableName()).Where("allocation_id = ?", allocationID).
+		Order("sequence DESC").Offset(keep-1).Limit(1).Pluck("sequence", &sequences).Error
+	if err != nil || len(sequences) == 0 {
+		return err
+	}
+	err = db.Table((WriteMarkerEntity{}).TableName()).
+		Where("allocation_id = ? AND sequence < ? AND history", allocationID, sequences[0]).
+		Update("history", false).Error
+	if err != nil {
+		return err
+	}
+	return db.Exec("DELETE FROM reference_objects_history WHERE allocation_id = ? AND valid_to_seq <= ?",
+		allocationID, sequences[0]).Error
+}
+
+// GetWriteMarkers returns at most limit write markers of the allocation,
+// latest first, the ones before the sequence number passed if not 0.
+func GetWriteMarkers(ctx context.Context, allocationID string, beforeSequence int64, limit int) ([]*WriteMarkerRecord, error) {
+	db := datastore.GetStore().GetTransaction(ctx)
+	query := db.Where("allocation_id = ?", allocationID)
+	if beforeSequence > 0 {
+		query = query.Where("sequence < ?", beforeSequence)
+	}
+	var records []*WriteMarkerRecord
+	err := query.Order("sequence DESC").Limit(limit).Find(&records).Error
+	return records, err
+}
+
 func GetWriteMarkersInRange(ctx context.Context, allocationID string, startAllocationRoot string, endAllocationRoot string) ([]*WriteMarkerEntity, error) {
 	db := datastore.GetStore().GetTransaction(ctx)
 	var seqRange []int64
@@ -5,9 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+
+	. "0chain.net/core/logging"
+	"go.uber.org/zap"
 )
 
 /*AppErrorHeader - a http response header to send an application error code */
@@ -17,6 +22,44 @@ const ClientHeader = "X-App-Client-ID"
 const ClientKeyHeader = "X-App-Client-Key"
 const TimestampHeader = "X-App-Timestamp"
 
+/*ErrCodeRangeNotSatisfiable - the error code of a RangeNotSatisfiable */
+const ErrCodeRangeNotSatisfiable = "range_not_satisfiable"
+
+/*RangeNotSatisfiable - an error ToByteStream responds with 416 and the Size
+* of the content in the Content-Range header
+ */
+type RangeNotSatisfiable struct {
+	Msg  string
+	Size int64
+}
+
+func (err *RangeNotSatisfiable) Error() string {
+	return fmt.Sprintf("%s: %s", ErrCodeRangeNotSatisfiable, err.Msg)
+}
+
+/*NewRangeNotSatisfiable - create a range error for content of size bytes */
+func NewRangeNotSatisfiable(size int64, format string, args ...interface{}) *RangeNotSatisfiable {
+	return &RangeNotSatisfiable{Msg: fmt.Sprintf(format, args...), Size: size}
+}
+
+/*ByteStream - a byte stream response of Size bytes read from Data,
+* ToByteStream closes Data once it is written
+ */
+type ByteStream struct {
+	Data io.ReadCloser
+	Size int64
+}
+
+/*PartialContent - a byte stream response for a satisfiable range request,
+* Start and End are inclusive offsets of Data within content of Size bytes
+ */
+type PartialContent struct {
+	Data  io.ReadCloser
+	Start int64
+	End   int64
+	Size  int64
+}
+
 /*ReqRespHandlerf - a type for the default hanlder signature */
 type ReqRespHandlerf func(w http.ResponseWriter, r *http.Request)
 
@@ -58,29 +101,73 @@ func getContext(r *http.Request) (context.Context, error) {
 
 var domainRE = regexp.MustCompile(`^(?:https?:\/\/)?(?:[^@\/\n]+@)?(?:www\.)?([^:\/\n]+)`)
 
+/*closeByteStream - close the data of a byte stream response not written */
+func closeByteStream(data interface{}) {
+	switch rawdata := data.(type) {
+	case *ByteStream:
+		rawdata.Data.Close()
+	case *PartialContent:
+		rawdata.Data.Close()
+	case io.Closer:
+		rawdata.Close()
+	}
+}
+
+/*copyByteStream - write size bytes of data, logging a short write */
+func copyByteStream(w io.Writer, data io.Reader, size int64) {
+	written, err := io.CopyN(w, data, size)
+	if err != nil {
+		Logger.Error("Short write of the byte stream",
+			zap.Int64("written", written), zap.Int64("size", size), zap.Error(err))
+	}
+}
+
 func ToByteStream(handler JSONResponderF) ReqRespHandlerf {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		data, err := handler(ctx, r)
 		if err != nil {
-			if cerr, ok := err.(*Error); ok {
+			closeByteStream(data)
+			var status = 400
+			if rerr, ok := err.(*RangeNotSatisfiable); ok {
+				w.Header().Set(AppErrorHeader, ErrCodeRangeNotSatisfiable)
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", rerr.Size))
+				status = http.StatusRequestedRangeNotSatisfiable
+			} else if cerr, ok := err.(*Error); ok {
 				w.Header().Set(AppErrorHeader, cerr.Code)
 			}
 			if data != nil {
 				responseString, _ := json.Marshal(data)
-				http.Error(w, string(responseString), 400)
+				http.Error(w, string(responseString), status)
 			} else {
-				http.Error(w, err.Error(), 400)
+				http.Error(w, err.Error(), status)
 			}
 
 		} else {
 			if data != nil {
 				//json.NewEncoder(w).Encode(data)
-				rawdata, ok := data.([]byte)
-				if ok {
+				switch rawdata := data.(type) {
+				case []byte:
 					w.Header().Set("Content-Type", "application/octet-stream")
+					w.Header().Set("Accept-Ranges", "bytes")
 					w.Write(rawdata)
-				} else {
+				case *ByteStream:
+					defer rawdata.Data.Close()
+					w.Header().Set("Content-Type", "application/octet-stream")
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Length", strconv.FormatInt(rawdata.Size, 10))
+					copyByteStream(w, rawdata.Data, rawdata.Size)
+				case *PartialContent:
+					defer rawdata.Data.Close()
+					w.Header().Set("Content-Type", "application/octet-stream")
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d",
+						rawdata.Start, rawdata.End, rawdata.Size))
+					w.Header().Set("Content-Length",
+						strconv.FormatInt(rawdata.End-rawdata.Start+1, 10))
+					w.WriteHeader(http.StatusPartialContent)
+					copyByteStream(w, rawdata.Data, rawdata.End-rawdata.Start+1)
+				default:
 					w.Header().Set("Content-Type", "application/json")
 					json.NewEncoder(w).Encode(data)
 				}
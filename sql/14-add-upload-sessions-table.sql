@@ -0,0 +1,22 @@
+\connect blobber_meta;
+
+CREATE TABLE upload_sessions (
+    session_id VARCHAR(64) PRIMARY KEY,
+    connection_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    client_id VARCHAR(64) NOT NULL,
+    operation VARCHAR(64) NOT NULL,
+    path TEXT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    upload_meta TEXT NOT NULL,
+    uploaded_size BIGINT NOT NULL DEFAULT 0,
+    status INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_upload_sessions_connection ON upload_sessions (connection_id);
+
+CREATE TRIGGER upload_sessions_modtime BEFORE UPDATE ON upload_sessions FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
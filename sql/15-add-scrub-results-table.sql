@@ -0,0 +1,19 @@
+\connect blobber_meta;
+
+CREATE TABLE scrub_results (
+    ref_id BIGINT PRIMARY KEY,
+    allocation_id VARCHAR(64) NOT NULL,
+    path TEXT NOT NULL,
+    content_hash VARCHAR(64) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    last_scrubbed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_scrub_results_status ON scrub_results (status);
+
+CREATE TRIGGER scrub_results_modtime BEFORE UPDATE ON scrub_results FOR EACH ROW EXECUTE PROCEDURE update_modified_column();
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
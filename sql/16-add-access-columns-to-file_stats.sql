@@ -0,0 +1,14 @@
+\connect blobber_meta;
+
+-- files existing before access times are tracked count as accessed when
+-- they were last updated
+ALTER TABLE file_stats ADD COLUMN last_accessed_at TIMESTAMP;
+UPDATE file_stats SET last_accessed_at = reference_objects.updated_at
+    FROM reference_objects WHERE reference_objects.id = file_stats.ref_id;
+UPDATE file_stats SET last_accessed_at = file_stats.updated_at WHERE last_accessed_at IS NULL;
+ALTER TABLE file_stats ALTER COLUMN last_accessed_at SET NOT NULL;
+ALTER TABLE file_stats ADD COLUMN num_of_cold_reads BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_file_stats_last_accessed_at ON file_stats (last_accessed_at);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
@@ -0,0 +1,7 @@
+\connect blobber_meta;
+
+CREATE INDEX idx_reference_objects_name ON reference_objects (allocation_id, parent_path, name, id);
+CREATE INDEX idx_reference_objects_size ON reference_objects (allocation_id, parent_path, size, id);
+CREATE INDEX idx_reference_objects_updated_at ON reference_objects (allocation_id, parent_path, updated_at, id);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
@@ -0,0 +1,14 @@
+\connect blobber_meta;
+
+-- custom meta is free text, parsed as json where possible
+CREATE OR REPLACE FUNCTION custom_meta_json(meta TEXT) RETURNS JSONB AS $$
+BEGIN
+    RETURN meta::jsonb;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE INDEX idx_reference_objects_path ON reference_objects (allocation_id, path text_pattern_ops);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
@@ -0,0 +1,81 @@
+\connect blobber_meta;
+
+-- Every version of the refs, valid from the write marker committing it until
+-- the write marker superseding it, to rebuild the tree as of a past write
+-- marker. Write markers are ordered by their sequence, allocation roots of
+-- an allocation are committed one at a time. Versions not committed by a
+-- write marker yet have no valid_from_seq, and the versions superseded but
+-- not by a write marker yet no valid_to_seq.
+CREATE TABLE reference_objects_history (
+    id BIGSERIAL PRIMARY KEY,
+    ref_id BIGINT NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    lookup_hash VARCHAR(64) NOT NULL,
+    path TEXT NOT NULL,
+    parent_path TEXT,
+    data JSONB NOT NULL,
+    superseded BOOLEAN NOT NULL DEFAULT FALSE,
+    valid_from_seq BIGINT,
+    valid_to_seq BIGINT
+);
+
+CREATE INDEX idx_reference_objects_history_ref ON reference_objects_history (ref_id) WHERE NOT superseded;
+CREATE INDEX idx_reference_objects_history_uncommitted ON reference_objects_history (allocation_id) WHERE valid_from_seq IS NULL;
+CREATE INDEX idx_reference_objects_history_superseded ON reference_objects_history (allocation_id) WHERE superseded AND valid_to_seq IS NULL;
+CREATE INDEX idx_reference_objects_history_valid_to ON reference_objects_history (allocation_id, valid_to_seq);
+CREATE INDEX idx_reference_objects_history_parent_path ON reference_objects_history (allocation_id, parent_path, valid_from_seq);
+CREATE INDEX idx_reference_objects_history_path ON reference_objects_history (allocation_id, path, valid_from_seq);
+CREATE INDEX idx_reference_objects_history_lookup_hash ON reference_objects_history (allocation_id, lookup_hash, valid_from_seq);
+
+CREATE OR REPLACE FUNCTION record_reference_objects_history()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        -- a version superseded before a write marker committed it is never
+        -- part of a tree, as the intermediate hashes of directories
+        DELETE FROM reference_objects_history
+            WHERE ref_id = OLD.id AND NOT superseded AND valid_from_seq IS NULL;
+        UPDATE reference_objects_history SET superseded = TRUE
+            WHERE ref_id = OLD.id AND NOT superseded;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        INSERT INTO reference_objects_history (ref_id, allocation_id, lookup_hash, path, parent_path, data)
+            VALUES (NEW.id, NEW.allocation_id, NEW.lookup_hash, NEW.path, NEW.parent_path, to_jsonb(NEW));
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER reference_objects_history AFTER INSERT OR UPDATE OR DELETE ON reference_objects FOR EACH ROW EXECUTE PROCEDURE record_reference_objects_history();
+
+-- a write marker commits the versions written since the previous one, in
+-- its transaction or not
+CREATE OR REPLACE FUNCTION commit_reference_objects_history()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE reference_objects_history SET valid_from_seq = NEW.sequence
+        WHERE allocation_id = NEW.allocation_id AND valid_from_seq IS NULL;
+    UPDATE reference_objects_history SET valid_to_seq = NEW.sequence
+        WHERE allocation_id = NEW.allocation_id AND superseded AND valid_to_seq IS NULL;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER write_markers_history AFTER INSERT ON write_markers FOR EACH ROW EXECUTE PROCEDURE commit_reference_objects_history();
+
+-- whether the refs as of the write marker can be rebuilt, until its history
+-- is pruned
+ALTER TABLE write_markers ADD COLUMN history BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- the refs as they are now are the versions of the latest write marker,
+-- older write markers can't be rebuilt. The refs of allocations without
+-- write markers are left for their first one.
+INSERT INTO reference_objects_history (ref_id, allocation_id, lookup_hash, path, parent_path, data, valid_from_seq)
+    SELECT id, allocation_id, lookup_hash, path, parent_path, to_jsonb(reference_objects),
+        (SELECT MAX(sequence) FROM write_markers WHERE write_markers.allocation_id = reference_objects.allocation_id)
+    FROM reference_objects;
+UPDATE write_markers SET history = FALSE
+    WHERE sequence NOT IN (SELECT MAX(sequence) FROM write_markers GROUP BY allocation_id);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO blobber_user;
@@ -0,0 +1,31 @@
+\connect blobber_meta;
+
+CREATE TABLE file_versions (
+    id BIGSERIAL PRIMARY KEY,
+    ref_id BIGINT NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    version BIGINT NOT NULL,
+    content_hash VARCHAR(64) NOT NULL,
+    merkle_root VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    actual_file_size BIGINT NOT NULL DEFAULT 0,
+    actual_file_hash VARCHAR(64) NOT NULL,
+    mimetype VARCHAR(64) NOT NULL,
+    custom_meta TEXT NOT NULL,
+    thumbnail_size BIGINT NOT NULL DEFAULT 0,
+    thumbnail_hash VARCHAR(64) NOT NULL DEFAULT '',
+    actual_thumbnail_size BIGINT NOT NULL DEFAULT 0,
+    actual_thumbnail_hash VARCHAR(64) NOT NULL DEFAULT '',
+    encrypted_key TEXT,
+    write_marker VARCHAR(64) NOT NULL,
+    on_cloud BOOLEAN NOT NULL DEFAULT FALSE,
+    modified_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (ref_id, version)
+);
+
+CREATE INDEX idx_file_versions_content_hash ON file_versions (allocation_id, content_hash);
+CREATE INDEX idx_file_versions_thumbnail_hash ON file_versions (allocation_id, thumbnail_hash);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO blobber_user;
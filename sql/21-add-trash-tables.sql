@@ -0,0 +1,27 @@
+\connect blobber_meta;
+
+CREATE TABLE trash_entries (
+    id BIGSERIAL PRIMARY KEY,
+    allocation_id VARCHAR(64) NOT NULL,
+    ref_id BIGINT NOT NULL,
+    path TEXT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(10) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    deleted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_trash_entries_allocation ON trash_entries (allocation_id, id);
+CREATE INDEX idx_trash_entries_expires_at ON trash_entries (expires_at);
+
+CREATE TABLE trash_refs (
+    entry_id BIGINT NOT NULL REFERENCES trash_entries(id),
+    ref_id BIGINT NOT NULL,
+    PRIMARY KEY (entry_id, ref_id)
+);
+
+CREATE INDEX idx_trash_refs_ref ON trash_refs (ref_id);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO blobber_user;
@@ -0,0 +1,6 @@
+\connect blobber_meta;
+
+CREATE INDEX idx_reference_objects_expires_at ON reference_objects (((attributes->>'expires_at')::bigint))
+    WHERE deleted_at IS NULL AND type = 'f';
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
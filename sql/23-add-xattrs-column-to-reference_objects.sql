@@ -0,0 +1,7 @@
+\connect blobber_meta;
+
+ALTER TABLE reference_objects ADD COLUMN xattrs JSONB;
+
+CREATE INDEX idx_reference_objects_xattrs ON reference_objects USING GIN (xattrs);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
@@ -0,0 +1,16 @@
+\connect blobber_meta;
+
+-- The connections committed to the database whose changes are still to be
+-- committed to the file store, finished at startup after a crash or retried
+-- after a failure. The content hashes released by the changes are known
+-- once they're applied only, they're journaled with them.
+CREATE TABLE commit_journal (
+    id BIGSERIAL PRIMARY KEY,
+    connection_id VARCHAR(64) NOT NULL,
+    allocation_id VARCHAR(64) NOT NULL,
+    released_content JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO blobber_user;
+GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO blobber_user;